@@ -1,45 +1,247 @@
 package agent
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/CSXL/go-agent/executor"
 	"github.com/CSXL/go-agent/resource"
 	"github.com/CSXL/go-agent/scheduler"
 	"github.com/CSXL/go-agent/task"
 )
 
+// ErrAgentStopped is returned when a task is submitted to an agent that is draining or has stopped.
+var ErrAgentStopped = errors.New("agent stopped")
+
+// State is the lifecycle state of an Agent.
+type State int
+
+const (
+	// New means the agent has not been started. Tasks submitted to it are queued until it is.
+	New State = iota
+	// Running means the agent is executing tasks.
+	Running
+	// Draining means the agent no longer accepts tasks and is waiting for its tasks to complete.
+	Draining
+	// Stopped means the agent has stopped. It may be started again.
+	Stopped
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case New:
+		return "new"
+	case Running:
+		return "running"
+	case Draining:
+		return "draining"
+	case Stopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
 // Agent is a high-level interface for managing concurrent tasks and shared resources.
 type Agent struct {
-	executor    *executor.Executor
 	resourceMgr *resource.Manager
-	scheduler   *scheduler.Scheduler
+
+	// lifecycle serializes Start, Stop and Shutdown.
+	lifecycle sync.Mutex
+
+	mu            sync.Mutex
+	workerCount   int
+	opts          options
+	state         State
+	executor      *executor.Executor
+	scheduler     *scheduler.Scheduler
+	cancelDrain   context.CancelFunc
+	jobs          map[string]scheduler.Job
+	subscriptions map[*subscription]struct{}
 }
 
-// NewAgent creates a new Agent with the given number of workers.
-func NewAgent(workerCount int) *Agent {
-	exec := executor.NewExecutor(workerCount)
-	resMgr := resource.NewManager()
-	sched := scheduler.NewScheduler(exec, resMgr)
+// subscription is a function subscribed to the agent's scheduling events, which is subscribed again
+// to the scheduler of a restarted agent.
+type subscription struct {
+	fn          func(scheduler.Event)
+	unsubscribe func()
+}
 
-	return &Agent{
-		executor:    exec,
-		resourceMgr: resMgr,
-		scheduler:   sched,
+// NewAgent creates a new Agent with the given number of workers and options.
+func NewAgent(workerCount int, opts ...Option) *Agent {
+	a := &Agent{
+		workerCount:   workerCount,
+		resourceMgr:   resource.NewManager(),
+		jobs:          make(map[string]scheduler.Job),
+		subscriptions: make(map[*subscription]struct{}),
+		opts:          options{retention: scheduler.DefaultRetention},
+	}
+	for _, opt := range opts {
+		opt(&a.opts)
 	}
+	a.build()
+	return a
+}
+
+// build creates a fresh executor and scheduler configured with the agent's options, and adds the agent's
+// recurring jobs and subscriptions to the scheduler. It must be called with a.mu held.
+func (a *Agent) build() {
+	o := a.opts
+	exec := executor.NewExecutor(a.workerCount)
+	exec.SetCrashOnPanic(o.crashOnPanic)
+	sched := scheduler.NewScheduler(exec, a.resourceMgr)
+	if o.clock != nil {
+		sched.SetClock(o.clock)
+	}
+	if o.policy != nil {
+		sched.SetPolicy(o.policy)
+	}
+	sched.SetQueueLimit(o.queueCapacity, o.overflow)
+	sched.SetAging(o.aging)
+	sched.SetPreemption(o.preemptions)
+	sched.SetIdempotencyWindow(o.idempotency)
+	sched.SetAutoscale(o.autoscale)
+	sched.SetRetention(o.retention)
+	for group, weight := range o.groupWeights {
+		sched.SetGroupWeight(group, weight)
+	}
+	for group, limit := range o.rateLimits {
+		sched.SetRateLimit(group, limit)
+	}
+	for _, job := range a.jobs {
+		// The jobs were valid when they were added, so they are valid for a fresh scheduler.
+		_ = sched.AddJob(job)
+	}
+	for sub := range a.subscriptions {
+		sub.unsubscribe = sched.Subscribe(sub.fn)
+	}
+
+	a.executor = exec
+	a.scheduler = sched
+}
+
+// State returns the lifecycle state of the agent.
+func (a *Agent) State() State {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state
 }
 
-// Start initializes the agent and starts its scheduler and executor.
+// Start initializes the agent and starts its scheduler and executor. Starting a running agent has no effect.
+// A stopped agent is restarted with a fresh executor and scheduler, configured with its options, group weights,
+// rate limits, recurring jobs and subscriptions; tasks submitted before it stopped are no longer known to it.
+// Registered resources are kept. If the agent is draining, Start waits for it to stop before restarting it.
 func (a *Agent) Start() {
+	a.lifecycle.Lock()
+	defer a.lifecycle.Unlock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch a.state {
+	case Running:
+		return
+	case Stopped:
+		a.build()
+	}
 	a.scheduler.Start()
+	a.state = Running
 }
 
-// Stop gracefully shuts down the agent and its scheduler and executor.
+// Stop shuts down the agent and its scheduler and executor. Tasks that have not completed, including running
+// tasks, are canceled with scheduler.ErrStopped as the cause. Stopping an agent that is draining cancels the
+// drain, as if the context passed to Shutdown were done. Stopping a stopped agent has no effect.
 func (a *Agent) Stop() {
-	a.scheduler.Stop()
+	a.mu.Lock()
+	if a.cancelDrain != nil {
+		a.cancelDrain()
+	}
+	a.mu.Unlock()
+
+	a.lifecycle.Lock()
+	defer a.lifecycle.Unlock()
+	sched, state := a.current()
+	if state == Stopped {
+		return
+	}
+	sched.Stop()
+	a.setState(Stopped)
 }
 
 // SoftStop gracefully shuts down the agent and its scheduler and executor after all tasks have completed.
 func (a *Agent) SoftStop() {
-	a.scheduler.SoftStop()
+	_, _ = a.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting tasks and waits for queued and running tasks to complete until ctx is done,
+// then cancels the tasks that have not completed and stops the agent. It returns the abandoned tasks,
+// along with the context's error if there were any. An agent that has not been started is started so that
+// its queued tasks can complete. Shutting down a stopped agent has no effect.
+func (a *Agent) Shutdown(ctx context.Context) ([]*task.Task, error) {
+	a.lifecycle.Lock()
+	defer a.lifecycle.Unlock()
+
+	a.mu.Lock()
+	if a.state == Stopped {
+		a.mu.Unlock()
+		return nil, nil
+	}
+	if a.state == New {
+		a.scheduler.Start()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.state = Draining
+	a.cancelDrain = cancel
+	sched := a.scheduler
+	a.mu.Unlock()
+
+	abandoned, err := sched.Shutdown(ctx)
+
+	a.mu.Lock()
+	a.state = Stopped
+	a.cancelDrain = nil
+	a.mu.Unlock()
+	return abandoned, err
+}
+
+// current returns the agent's scheduler and lifecycle state.
+func (a *Agent) current() (*scheduler.Scheduler, State) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.scheduler, a.state
+}
+
+// sched returns the agent's scheduler.
+func (a *Agent) sched() *scheduler.Scheduler {
+	sched, _ := a.current()
+	return sched
+}
+
+// setState sets the agent's lifecycle state.
+func (a *Agent) setState(state State) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.state = state
+}
+
+// submit calls fn with the agent's scheduler to submit tasks, unless the agent is draining or stopped.
+// A submission the scheduler rejects because it is stopping is reported as ErrAgentStopped.
+func (a *Agent) submit(fn func(*scheduler.Scheduler) error) error {
+	sched, state := a.current()
+	if state == Draining || state == Stopped {
+		return ErrAgentStopped
+	}
+	if err := fn(sched); err != nil {
+		if errors.Is(err, scheduler.ErrStopped) {
+			return ErrAgentStopped
+		}
+		return err
+	}
+	return nil
 }
 
 // RegisterResource registers a shared resource with the agent's resource manager.
@@ -63,6 +265,164 @@ func (a *Agent) DeallocateResource(name string) error {
 }
 
 // SubmitTask submits a task to the agent's scheduler for execution.
-func (a *Agent) SubmitTask(t *task.Task) {
-	a.scheduler.Submit(t)
+// The task's dependencies must already have been submitted.
+func (a *Agent) SubmitTask(t *task.Task) error {
+	return a.submit(func(s *scheduler.Scheduler) error { return s.Submit(t) })
+}
+
+// TrySubmit submits a task like SubmitTask, but returns scheduler.ErrQueueFull
+// instead of waiting if the queue is full.
+func (a *Agent) TrySubmit(t *task.Task) error {
+	return a.submit(func(s *scheduler.Scheduler) error { return s.TrySubmit(t) })
+}
+
+// SubmitContext submits a task like SubmitTask, waiting for room in a full queue until ctx is done.
+func (a *Agent) SubmitContext(ctx context.Context, t *task.Task) error {
+	return a.submit(func(s *scheduler.Scheduler) error { return s.SubmitContext(ctx, t) })
+}
+
+// SubmitAt submits a task to be queued for execution at the given time. It can be canceled with CancelTask until it runs.
+func (a *Agent) SubmitAt(t *task.Task, at time.Time) error {
+	return a.submit(func(s *scheduler.Scheduler) error { return s.SubmitAt(t, at) })
+}
+
+// SubmitAfter submits a task to be queued for execution once d has elapsed.
+func (a *Agent) SubmitAfter(t *task.Task, d time.Duration) error {
+	return a.submit(func(s *scheduler.Scheduler) error { return s.SubmitAfter(t, d) })
+}
+
+// AddJob adds a recurring job, which submits a fresh task each time its schedule comes due.
+// The job is added again if the agent is restarted, until it is removed.
+func (a *Agent) AddJob(job scheduler.Job) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == Draining || a.state == Stopped {
+		return ErrAgentStopped
+	}
+	if err := a.scheduler.AddJob(job); err != nil {
+		return err
+	}
+	a.jobs[job.ID] = job
+	return nil
+}
+
+// RemoveJob stops a recurring job from running again.
+func (a *Agent) RemoveJob(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.jobs, id)
+	return a.scheduler.RemoveJob(id)
+}
+
+// Jobs returns the state of each recurring job, including the time it is next due, in the order they are next due.
+func (a *Agent) Jobs() []scheduler.JobInfo {
+	return a.sched().Jobs()
+}
+
+// SubmitGraph validates and submits a set of interdependent tasks atomically.
+// No task is submitted if any of them has already been submitted, depends on a task that is neither
+// in the set nor previously submitted, or if their dependencies form a cycle.
+func (a *Agent) SubmitGraph(tasks ...*task.Task) error {
+	return a.submit(func(s *scheduler.Scheduler) error { return s.SubmitGraph(tasks...) })
+}
+
+// Result returns the outcome of the most recently submitted task with the given ID. Completed tasks
+// are only known while they are among the most recently completed ones; see WithRetention.
+// The result is only complete once the task has finished; use Task.Wait to block until then.
+func (a *Agent) Result(id string) (task.Result, error) {
+	t, err := a.sched().Task(id)
+	if err != nil {
+		return task.Result{}, err
+	}
+	return t.Result(), nil
+}
+
+// UpdatePriority changes the priority of a task that has been submitted but has not yet started.
+// It returns an error if the task is unknown, already running, or finished.
+func (a *Agent) UpdatePriority(id string, priority task.Priority) error {
+	return a.sched().UpdatePriority(id, priority)
+}
+
+// EffectivePriority returns the priority a task is currently scheduled with, including any aging while it is queued.
+func (a *Agent) EffectivePriority(id string) (task.Priority, error) {
+	return a.sched().EffectivePriority(id)
+}
+
+// SetGroupWeight sets the weight of a group of tasks relative to other groups with tasks of the same priority.
+func (a *Agent) SetGroupWeight(group string, weight int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	WithGroupWeight(group, weight)(&a.opts)
+	a.scheduler.SetGroupWeight(group, weight)
+}
+
+// SetRateLimit limits how often the tasks of a group are dispatched. A limit with a Rate of zero or less removes it.
+func (a *Agent) SetRateLimit(group string, limit scheduler.RateLimit) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	WithRateLimit(group, limit)(&a.opts)
+	a.scheduler.SetRateLimit(group, limit)
+}
+
+// Resize changes the number of workers to n. New workers start immediately, and removed workers exit once
+// they have finished their current task. The agent keeps the new number of workers if it is restarted.
+func (a *Agent) Resize(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n < 1 {
+		n = 1
+	}
+	a.workerCount = n
+	a.scheduler.Resize(n)
+}
+
+// SetAutoscale adjusts the number of workers to the load, within the configuration's bounds, replacing any
+// previous configuration. A configuration with a Max of zero or less disables autoscaling.
+// See scheduler.Scheduler.SetAutoscale.
+func (a *Agent) SetAutoscale(cfg scheduler.Autoscale) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	WithAutoscale(cfg)(&a.opts)
+	a.scheduler.SetAutoscale(cfg)
+}
+
+// GroupStats returns queue-depth, dispatch and throttling statistics for each group of tasks, keyed by group.
+func (a *Agent) GroupStats() map[string]scheduler.GroupStats {
+	return a.sched().GroupStats()
+}
+
+// Subscribe registers fn to be called with each scheduling event, and returns a function that removes the subscription.
+// Subscriptions are kept if the agent is restarted.
+func (a *Agent) Subscribe(fn func(scheduler.Event)) (unsubscribe func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sub := &subscription{fn: fn, unsubscribe: a.scheduler.Subscribe(fn)}
+	a.subscriptions[sub] = struct{}{}
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		delete(a.subscriptions, sub)
+		sub.unsubscribe()
+	}
+}
+
+// CancelTask cancels the most recently submitted task with the given ID. A queued task is removed from
+// the scheduler and never runs, and a running task has its context canceled. The task's error wraps
+// scheduler.ErrCanceled as the cause, and any callers of Task.Wait are unblocked.
+func (a *Agent) CancelTask(id string) error {
+	return a.sched().Cancel(id, scheduler.ErrCanceled)
+}
+
+// CancelWhere cancels every unfinished task for which match returns true, and returns the number of tasks canceled.
+func (a *Agent) CancelWhere(match func(*task.Task) bool) int {
+	return len(a.sched().CancelWhere(match, scheduler.ErrCanceled))
+}
+
+// Go creates a task from fn, submits it to the agent, and returns a Future for its result.
+func Go[T any](a *Agent, id string, fn func(context.Context) (T, error), priority task.Priority) (*task.Future[T], error) {
+	f := task.NewFuture(id, fn, priority)
+	if err := a.SubmitTask(f.Task()); err != nil {
+		return nil, err
+	}
+	return f, nil
 }
@@ -4,11 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/CSXL/go-agent"
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/cron"
 	"github.com/CSXL/go-agent/resource"
+	"github.com/CSXL/go-agent/scheduler"
 	"github.com/CSXL/go-agent/task"
 )
 
@@ -93,3 +99,1018 @@ func TestAgentTaskCancellation(t *testing.T) {
 	task.Cancel()
 	a.SoftStop()
 }
+
+func TestAgentShutdown(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount)
+	a.Start()
+
+	done := task.NewTask("done", func(ctx context.Context) error {
+		return nil
+	}, task.HighPriority)
+	stuck := task.NewTask("stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, task.LowPriority)
+	if err := a.SubmitGraph(done, stuck); err != nil {
+		t.Fatal("failed to submit tasks:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	abandoned, err := a.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if len(abandoned) != 1 || abandoned[0] != stuck {
+		t.Fatalf("expected only the stuck task to be abandoned, got %v", abandoned)
+	}
+	if done.State() != task.Succeeded {
+		t.Errorf("expected completed task to succeed, got %s", done.State())
+	}
+	if !errors.Is(stuck.Err(), scheduler.ErrShutdown) {
+		t.Errorf("expected abandoned task to be canceled by the shutdown, got %v", stuck.Err())
+	}
+	if err := a.SubmitTask(task.NewTask("late", nil, task.LowPriority)); !errors.Is(err, agent.ErrAgentStopped) {
+		t.Errorf("expected submissions to be rejected after shutdown, got %v", err)
+	}
+}
+
+func TestAgentLifecycle(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount)
+	if a.State() != agent.New {
+		t.Fatalf("expected new state, got %s", a.State())
+	}
+
+	// Tasks submitted before the agent starts are queued until it does.
+	early := task.NewTask("early", func(ctx context.Context) error { return nil }, task.LowPriority)
+	if err := a.SubmitTask(early); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	a.Start()
+	a.Start()
+	if a.State() != agent.Running {
+		t.Fatalf("expected running state, got %s", a.State())
+	}
+	if err := early.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+
+	started := make(chan struct{})
+	draining := task.NewTask("draining", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, task.LowPriority)
+	if err := a.SubmitTask(draining); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	<-started
+
+	shutdown := make(chan error)
+	go func() {
+		_, err := a.Shutdown(context.Background())
+		shutdown <- err
+	}()
+	for a.State() != agent.Draining {
+		time.Sleep(time.Millisecond)
+	}
+	if err := a.SubmitTask(task.NewTask("rejected", nil, task.LowPriority)); !errors.Is(err, agent.ErrAgentStopped) {
+		t.Errorf("expected submissions to be rejected while draining, got %v", err)
+	}
+
+	// Stopping a draining agent cancels the drain.
+	a.Stop()
+	if err := <-shutdown; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the drain to be canceled, got %v", err)
+	}
+	if !errors.Is(draining.Err(), scheduler.ErrShutdown) {
+		t.Errorf("expected running task to be canceled by the shutdown, got %v", draining.Err())
+	}
+	if a.State() != agent.Stopped {
+		t.Fatalf("expected stopped state, got %s", a.State())
+	}
+
+	a.Stop()
+	a.SoftStop()
+	if err := a.SubmitTask(task.NewTask("late", nil, task.LowPriority)); !errors.Is(err, agent.ErrAgentStopped) {
+		t.Errorf("expected submissions to be rejected after stopping, got %v", err)
+	}
+	if _, err := agent.Go(a, "late", func(ctx context.Context) (int, error) { return 0, nil }, task.LowPriority); !errors.Is(err, agent.ErrAgentStopped) {
+		t.Errorf("expected futures to be rejected after stopping, got %v", err)
+	}
+}
+
+func TestAgentStop(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount)
+	a.Start()
+
+	started := make(chan struct{})
+	running := task.NewTask("running", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, task.LowPriority)
+	if err := a.SubmitTask(running); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		a.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected Stop to cancel the running task")
+	}
+	if !running.State().IsTerminal() || !errors.Is(running.Err(), scheduler.ErrStopped) {
+		t.Errorf("expected running task to be canceled, got %s: %v", running.State(), running.Err())
+	}
+}
+
+func TestAgentRestart(t *testing.T) {
+	workerCount := 1
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	a := agent.NewAgent(workerCount, agent.WithClock(c))
+	if err := a.RegisterResource("license", resource.NewSemaphore(1)); err != nil {
+		t.Fatal("failed to register resource:", err)
+	}
+	a.SetGroupWeight("reports", 3)
+
+	runs := make(chan struct{}, 1)
+	err := a.AddJob(scheduler.Job{
+		ID:       "cleanup",
+		Schedule: cron.Every(time.Minute),
+		Func: func(ctx context.Context) error {
+			runs <- struct{}{}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal("failed to add job:", err)
+	}
+	events := make(chan scheduler.Event, 16)
+	unsubscribe := a.Subscribe(func(e scheduler.Event) {
+		if e.TaskID == "restarted" {
+			events <- e
+		}
+	})
+	defer unsubscribe()
+
+	a.Start()
+	if err := a.SubmitTask(task.NewTask("before", func(ctx context.Context) error { return nil }, task.LowPriority)); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	a.Stop()
+
+	a.Start()
+	defer a.Stop()
+	if a.State() != agent.Running {
+		t.Fatalf("expected running state, got %s", a.State())
+	}
+	if _, err := a.Result("before"); err == nil {
+		t.Error("expected tasks from before the restart to be forgotten")
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	blocking := task.NewTask("blocking", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, task.LowPriority)
+	if err := a.SubmitTask(blocking); err != nil {
+		t.Fatal("failed to submit task after restarting:", err)
+	}
+	<-started
+
+	restarted := task.NewTask("restarted", func(ctx context.Context) error { return nil }, task.LowPriority)
+	restarted.SetGroup("reports")
+	restarted.Require("license", 1)
+	if err := a.SubmitTask(restarted); err != nil {
+		t.Fatal("failed to submit task after restarting:", err)
+	}
+	if err := a.UpdatePriority("restarted", task.HighPriority); err != nil {
+		t.Fatal("failed to update priority:", err)
+	}
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Error("expected subscriptions to be kept across restarts")
+	}
+	if stats := a.GroupStats()["reports"]; stats.Weight != 3 {
+		t.Errorf("expected group weight to be kept across restarts, got %d", stats.Weight)
+	}
+	close(release)
+	if err := restarted.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+	if restarted.State() != task.Succeeded {
+		t.Errorf("expected succeeded state, got %s", restarted.State())
+	}
+
+	c.Advance(time.Minute)
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Error("expected recurring jobs to be kept across restarts")
+	}
+}
+
+func TestAgentResult(t *testing.T) {
+	workerCount := 4
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	expectedErr := errors.New("task failed")
+	fn := func(ctx context.Context) error {
+		return expectedErr
+	}
+
+	tsk := task.NewTask("failing", fn, task.MediumPriority)
+	a.SubmitTask(tsk)
+
+	if err := tsk.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+
+	res, err := a.Result("failing")
+	if err != nil {
+		t.Fatal("failed to get result:", err)
+	}
+	if !errors.Is(res.Err, expectedErr) {
+		t.Errorf("expected error %v, got %v", expectedErr, res.Err)
+	}
+	if res.Attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", res.Attempts)
+	}
+
+	if _, err := a.Result("missing"); err == nil {
+		t.Error("expected error for unknown task")
+	}
+}
+
+func TestAgentWatch(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	// The watcher calls back into the agent when the task is queued, while the task is being submitted.
+	states := make(chan task.State, 1)
+	tsk := task.NewTask("watched", func(ctx context.Context) error { return nil }, task.MediumPriority)
+	tsk.Watch(func(tr task.Transition) {
+		if tr.To == task.Ready {
+			res, err := a.Result(tr.TaskID)
+			if err != nil {
+				t.Error("failed to get result:", err)
+			}
+			states <- res.State
+		}
+	})
+
+	submitted := make(chan error, 1)
+	go func() { submitted <- a.SubmitTask(tsk) }()
+	select {
+	case err := <-submitted:
+		if err != nil {
+			t.Fatal("failed to submit task:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("submitting a watched task deadlocked")
+	}
+	<-states
+	if err := tsk.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+}
+
+func TestAgentGo(t *testing.T) {
+	workerCount := 4
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	f, err := agent.Go(a, "answer", func(ctx context.Context) (int, error) {
+		return 42, nil
+	}, task.MediumPriority)
+	if err != nil {
+		t.Fatal("failed to submit future:", err)
+	}
+
+	v, err := f.Get(context.Background())
+	if err != nil {
+		t.Fatal("failed to get future value:", err)
+	}
+	if v != 42 {
+		t.Errorf("expected 42, got %d", v)
+	}
+}
+
+func TestAgentThen(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	f, err := agent.Go(a, "answer", func(ctx context.Context) (int, error) {
+		return 21, nil
+	}, task.MediumPriority)
+	if err != nil {
+		t.Fatal("failed to submit future:", err)
+	}
+	doubled, err := task.Then(a.SubmitTask, f, "doubled", func(ctx context.Context, v int) (int, error) {
+		return v * 2, nil
+	})
+	if err != nil {
+		t.Fatal("failed to submit continuation:", err)
+	}
+
+	v, err := doubled.Get(context.Background())
+	if err != nil {
+		t.Fatal("failed to get future value:", err)
+	}
+	if v != 42 {
+		t.Errorf("expected 42, got %d", v)
+	}
+	if _, err := a.Result("doubled"); err != nil {
+		t.Error("expected the continuation to be submitted to the agent:", err)
+	}
+}
+
+func TestAgentDependencies(t *testing.T) {
+	workerCount := 4
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	var first time.Time
+	dep := task.NewTask("dep", func(ctx context.Context) error {
+		time.Sleep(100 * time.Millisecond)
+		first = time.Now()
+		return nil
+	}, task.MediumPriority)
+
+	var second time.Time
+	dependent := task.NewTask("dependent", func(ctx context.Context) error {
+		second = time.Now()
+		return nil
+	}, task.HighPriority)
+	dependent.AddDependency(dep)
+
+	a.SubmitTask(dep)
+	a.SubmitTask(dependent)
+
+	if err := dependent.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+	if second.Before(first) {
+		t.Error("dependent task ran before its dependency completed")
+	}
+}
+
+func TestAgentSubmitGraph(t *testing.T) {
+	workerCount := 4
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	fn := func(ctx context.Context) error {
+		return nil
+	}
+	first := task.NewTask("first", fn, task.MediumPriority)
+	second := task.NewTask("second", fn, task.MediumPriority)
+	second.AddDependency(first)
+	first.AddDependency(second)
+
+	if err := a.SubmitGraph(first, second); err == nil {
+		t.Fatal("expected error for dependency cycle")
+	}
+
+	first.RemoveDependency(second)
+	if err := a.SubmitGraph(first, second); err != nil {
+		t.Fatal("failed to submit graph:", err)
+	}
+	if err := second.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+}
+
+func TestAgentPanic(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	tsk := task.NewTask("panicking", func(ctx context.Context) error {
+		panic("boom")
+	}, task.MediumPriority)
+	if err := a.SubmitTask(tsk); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	if err := tsk.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+
+	res, err := a.Result("panicking")
+	if err != nil {
+		t.Fatal("failed to get result:", err)
+	}
+	var panicErr *task.PanicError
+	if !errors.As(res.Err, &panicErr) {
+		t.Errorf("expected panic error, got %v", res.Err)
+	}
+}
+
+func TestAgentCrashOnPanic(t *testing.T) {
+	if os.Getenv("AGENT_CRASH_ON_PANIC") == "1" {
+		a := agent.NewAgent(1, agent.WithCrashOnPanic())
+		a.Start()
+		tsk := task.NewTask("panicking", func(ctx context.Context) error {
+			panic("boom")
+		}, task.MediumPriority)
+		_ = a.SubmitTask(tsk)
+		_ = tsk.Wait(context.Background())
+		return
+	}
+
+	// The panic crashes the process, so it is run in a subprocess.
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAgentCrashOnPanic$")
+	cmd.Env = append(os.Environ(), "AGENT_CRASH_ON_PANIC=1")
+	out, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected process to crash, got %v", err)
+	}
+	if !strings.Contains(string(out), "panic: boom") {
+		t.Errorf("expected panic output, got %s", out)
+	}
+}
+
+func TestAgentCancelTask(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	blocker := task.NewTask("blocker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, task.MediumPriority)
+	if err := a.SubmitTask(blocker); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+
+	queued := task.NewTask("queued", func(ctx context.Context) error {
+		return nil
+	}, task.MediumPriority)
+	queued.AddDependencyWithPolicy(blocker, task.RunOnFailure)
+	if err := a.SubmitTask(queued); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+
+	if err := a.CancelTask("queued"); err != nil {
+		t.Fatal("failed to cancel task:", err)
+	}
+	if err := queued.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+	if queued.Attempts() != 0 {
+		t.Error("expected canceled task not to run")
+	}
+
+	n := a.CancelWhere(func(tsk *task.Task) bool {
+		return tsk.ID() == "blocker"
+	})
+	if n != 1 {
+		t.Errorf("expected 1 canceled task, got %d", n)
+	}
+	if err := blocker.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+	if blocker.State() != task.Canceled {
+		t.Errorf("expected canceled state, got %s", blocker.State())
+	}
+	if err := a.CancelTask("missing"); err == nil {
+		t.Error("expected error for unknown task")
+	}
+}
+
+func TestAgentQueueLimit(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount, agent.WithQueueLimit(1, scheduler.OverflowBlock))
+	a.Start()
+	defer a.SoftStop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocker := task.NewTask("blocker", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, task.MediumPriority)
+	if err := a.SubmitTask(blocker); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	<-started
+
+	queued := task.NewTask("queued", func(ctx context.Context) error {
+		return nil
+	}, task.MediumPriority)
+	if err := a.TrySubmit(queued); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+
+	waiting := task.NewTask("waiting", func(ctx context.Context) error {
+		return nil
+	}, task.MediumPriority)
+	if err := a.TrySubmit(waiting); !errors.Is(err, scheduler.ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	close(release)
+	if err := a.SubmitContext(context.Background(), waiting); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	if err := waiting.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+}
+
+func TestAgentUpdatePriority(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocker := task.NewTask("blocker", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, task.LowPriority)
+	if err := a.SubmitTask(blocker); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	<-started
+
+	queued := task.NewTask("queued", func(ctx context.Context) error {
+		return nil
+	}, task.LowPriority)
+	if err := a.SubmitTask(queued); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+
+	events := make(chan scheduler.Event, 1)
+	unsubscribe := a.Subscribe(func(e scheduler.Event) {
+		events <- e
+	})
+	defer unsubscribe()
+
+	if err := a.UpdatePriority("queued", task.HighPriority); err != nil {
+		t.Fatal("failed to update priority:", err)
+	}
+	if e := <-events; e.Type != scheduler.PriorityChanged || e.NewPriority != task.HighPriority {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if queued.Priority() != task.HighPriority {
+		t.Errorf("expected high priority, got %d", queued.Priority())
+	}
+	if err := a.UpdatePriority("blocker", task.HighPriority); !errors.Is(err, scheduler.ErrTaskRunning) {
+		t.Errorf("expected ErrTaskRunning, got %v", err)
+	}
+	close(release)
+}
+
+func TestAgentAging(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount, agent.WithAging(time.Millisecond))
+	a.Start()
+	defer a.SoftStop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocker := task.NewTask("blocker", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, task.HighPriority)
+	if err := a.SubmitTask(blocker); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	<-started
+
+	queued := task.NewTask("queued", func(ctx context.Context) error {
+		return nil
+	}, task.LowPriority)
+	if err := a.SubmitTask(queued); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	priority, err := a.EffectivePriority("queued")
+	if err != nil {
+		t.Fatal("failed to get effective priority:", err)
+	}
+	if priority <= task.LowPriority {
+		t.Errorf("expected aged priority above %d, got %d", task.LowPriority, priority)
+	}
+	close(release)
+}
+
+func TestAgentPolicy(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount, agent.WithPolicy(scheduler.NewEDFPolicy))
+	a.Start()
+	defer a.SoftStop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocker := task.NewTask("blocker", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, task.HighPriority)
+	if err := a.SubmitTask(blocker); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	<-started
+
+	ran := make(chan string, 2)
+	now := time.Now()
+	for _, tc := range []struct {
+		id       string
+		priority task.Priority
+		deadline time.Time
+	}{
+		{"later", task.HighPriority, now.Add(time.Hour)},
+		{"sooner", task.LowPriority, now.Add(time.Minute)},
+	} {
+		id := tc.id
+		tsk := task.NewTask(id, func(ctx context.Context) error {
+			ran <- id
+			return nil
+		}, tc.priority)
+		tsk.SetDeadline(tc.deadline)
+		if err := a.SubmitTask(tsk); err != nil {
+			t.Fatal("failed to submit task:", err)
+		}
+	}
+	close(release)
+
+	if first := <-ran; first != "sooner" {
+		t.Errorf("expected the task with the earliest deadline to run first, got %q", first)
+	}
+	<-ran
+}
+
+func TestAgentPreemption(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount, agent.WithPreemption(1))
+	a.Start()
+	defer a.SoftStop()
+
+	started := make(chan struct{}, 1)
+	low := task.NewTask("low", func(ctx context.Context) error {
+		if task.Attempt(ctx) > 1 {
+			return nil
+		}
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}, task.LowPriority)
+	low.SetPreemptible(true)
+	if err := a.SubmitTask(low); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	<-started
+
+	high := task.NewTask("high", func(ctx context.Context) error {
+		return nil
+	}, task.HighPriority)
+	if err := a.SubmitTask(high); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	if err := low.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+
+	if low.State() != task.Succeeded {
+		t.Errorf("expected preempted task to succeed when run again, got %s", low.State())
+	}
+	if low.Preemptions() != 1 {
+		t.Errorf("expected 1 preemption, got %d", low.Preemptions())
+	}
+	if !high.FinishedAt().Before(low.FinishedAt()) {
+		t.Error("expected high-priority task to finish before the preempted task")
+	}
+}
+
+func TestAgentIdempotency(t *testing.T) {
+	workerCount := 2
+	a := agent.NewAgent(workerCount, agent.WithIdempotencyWindow(time.Minute))
+	a.Start()
+	defer a.SoftStop()
+
+	runs := 0
+	newWebhook := func(id string) *task.Task {
+		tsk := task.NewTask(id, func(ctx context.Context) error {
+			runs++
+			return nil
+		}, task.MediumPriority)
+		tsk.SetIdempotencyKey("webhook-42")
+		return tsk
+	}
+
+	first := newWebhook("delivery")
+	if err := a.SubmitTask(first); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	if err := first.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+
+	retry := newWebhook("redelivery")
+	if err := a.SubmitTask(retry); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	if err := retry.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+	if retry.State() != task.Succeeded {
+		t.Errorf("expected duplicate to share the succeeded result, got %s", retry.State())
+	}
+	if runs != 1 {
+		t.Errorf("expected the work to run once, got %d", runs)
+	}
+}
+
+func TestAgentGroupWeight(t *testing.T) {
+	workerCount := 2
+	a := agent.NewAgent(workerCount, agent.WithGroupWeight("batch", 3))
+	a.Start()
+
+	for i := 0; i < 4; i++ {
+		for _, group := range []string{"batch", "interactive"} {
+			tsk := task.NewTask(fmt.Sprintf("%s-%d", group, i), func(ctx context.Context) error {
+				return nil
+			}, task.MediumPriority)
+			tsk.SetGroup(group)
+			if err := a.SubmitTask(tsk); err != nil {
+				t.Fatal("failed to submit task:", err)
+			}
+		}
+	}
+	a.SoftStop()
+
+	stats := a.GroupStats()
+	if stats["batch"].Weight != 3 {
+		t.Errorf("expected batch weight 3, got %d", stats["batch"].Weight)
+	}
+	if stats["batch"].Dispatched != 4 || stats["batch"].Share != 0.5 {
+		t.Errorf("expected 4 of 8 dispatched tasks in the batch group, got %+v", stats)
+	}
+}
+
+func TestAgentRateLimit(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	workerCount := 2
+	a := agent.NewAgent(workerCount,
+		agent.WithClock(c),
+		agent.WithRateLimit("api", scheduler.RateLimit{Rate: 1, Burst: 1}),
+	)
+	a.Start()
+	defer a.SoftStop()
+
+	var tasks []*task.Task
+	for i := 0; i < 2; i++ {
+		tsk := task.NewTask(fmt.Sprintf("api-%d", i), func(ctx context.Context) error {
+			return nil
+		}, task.MediumPriority)
+		tsk.SetGroup("api")
+		if err := a.SubmitTask(tsk); err != nil {
+			t.Fatal("failed to submit task:", err)
+		}
+		tasks = append(tasks, tsk)
+	}
+	if err := tasks[0].Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if state := tasks[1].State(); state != task.Ready {
+		t.Errorf("expected rate-limited task to be waiting, got %s", state)
+	}
+
+	c.Advance(time.Second)
+	if err := tasks[1].Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+	if throttled := a.GroupStats()["api"].Throttled; throttled != time.Second {
+		t.Errorf("expected 1s throttled, got %s", throttled)
+	}
+}
+
+func TestAgentResize(t *testing.T) {
+	workerCount := 1
+	a := agent.NewAgent(workerCount)
+	a.Start()
+	defer a.SoftStop()
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	defer close(release)
+	for _, id := range []string{"first", "second"} {
+		id := id
+		err := a.SubmitTask(task.NewTask(id, func(ctx context.Context) error {
+			started <- id
+			<-release
+			return nil
+		}, task.MediumPriority))
+		if err != nil {
+			t.Fatal("failed to submit task:", err)
+		}
+	}
+	if id := <-started; id != "first" {
+		t.Fatalf("expected first task to start, got %s", id)
+	}
+
+	a.Resize(2)
+	select {
+	case id := <-started:
+		if id != "second" {
+			t.Errorf("expected second task to start, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected queued task to start on the new worker")
+	}
+}
+
+func TestAgentAutoscale(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	workerCount := 1
+	a := agent.NewAgent(workerCount,
+		agent.WithClock(c),
+		agent.WithAutoscale(scheduler.Autoscale{Min: 1, Max: 2, Interval: time.Second}),
+	)
+	scaled := make(chan scheduler.Event, 1)
+	a.Subscribe(func(e scheduler.Event) {
+		if e.Type == scheduler.Scaled {
+			scaled <- e
+		}
+	})
+	a.Start()
+	defer a.SoftStop()
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < 2; i++ {
+		err := a.SubmitTask(task.NewTask(fmt.Sprintf("task-%d", i), func(ctx context.Context) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		}, task.MediumPriority))
+		if err != nil {
+			t.Fatal("failed to submit task:", err)
+		}
+	}
+	<-started
+
+	c.Advance(time.Second)
+	e := <-scaled
+	if e.OldWorkers != 1 || e.NewWorkers != 2 || e.Reason != scheduler.ScaledForQueueDepth {
+		t.Errorf("unexpected scaling decision: %+v", e)
+	}
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Error("expected queued task to start after scaling up")
+	}
+}
+
+func TestAgentSubmitAt(t *testing.T) {
+	workerCount := 1
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	a := agent.NewAgent(workerCount, agent.WithClock(c))
+	a.Start()
+	defer a.SoftStop()
+
+	scheduled := task.NewTask("scheduled", func(ctx context.Context) error {
+		return nil
+	}, task.MediumPriority)
+	if err := a.SubmitAt(scheduled, c.Now().Add(3*time.Hour)); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	canceled := task.NewTask("canceled", func(ctx context.Context) error {
+		return nil
+	}, task.MediumPriority)
+	if err := a.SubmitAfter(canceled, time.Hour); err != nil {
+		t.Fatal("failed to submit task:", err)
+	}
+	if err := a.CancelTask("canceled"); err != nil {
+		t.Fatal("failed to cancel task:", err)
+	}
+
+	c.Advance(2 * time.Hour)
+	if scheduled.State() != task.Pending {
+		t.Errorf("expected pending state before the scheduled time, got %s", scheduled.State())
+	}
+	c.Advance(time.Hour)
+	if err := scheduled.Wait(context.Background()); err != nil {
+		t.Fatal("failed to wait for task:", err)
+	}
+	if scheduled.State() != task.Succeeded {
+		t.Errorf("expected succeeded state, got %s", scheduled.State())
+	}
+	if canceled.Attempts() != 0 {
+		t.Error("expected canceled task not to run")
+	}
+}
+
+func TestAgentRecurringJob(t *testing.T) {
+	workerCount := 1
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	a := agent.NewAgent(workerCount, agent.WithClock(c))
+	a.Start()
+	defer a.SoftStop()
+
+	schedule, err := cron.ParseInLocation("*/30 * * * *", time.UTC)
+	if err != nil {
+		t.Fatal("failed to parse schedule:", err)
+	}
+	runs := make(chan struct{}, 1)
+	err = a.AddJob(scheduler.Job{
+		ID:       "cleanup",
+		Schedule: schedule,
+		Func: func(ctx context.Context) error {
+			runs <- struct{}{}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal("failed to add job:", err)
+	}
+
+	c.Advance(30 * time.Minute)
+	<-runs
+	jobs := a.Jobs()
+	if len(jobs) != 1 || !jobs[0].Next.Equal(c.Now().Add(30*time.Minute)) {
+		t.Errorf("unexpected jobs: %+v", jobs)
+	}
+	if _, err := a.Result("cleanup#1"); err != nil {
+		t.Error("expected a task for the first run:", err)
+	}
+	if err := a.RemoveJob("cleanup"); err != nil {
+		t.Fatal("failed to remove job:", err)
+	}
+}
+
+func TestAgentTaskResources(t *testing.T) {
+	workerCount := 2
+	a := agent.NewAgent(workerCount)
+	if err := a.RegisterResource("license", resource.NewSemaphore(1)); err != nil {
+		t.Fatal("failed to register resource:", err)
+	}
+	a.Start()
+	defer a.SoftStop()
+
+	holding := make(chan string, 2)
+	release := make(chan struct{})
+	var tasks []*task.Task
+	for _, id := range []string{"first", "second"} {
+		id := id
+		tsk := task.NewTask(id, func(ctx context.Context) error {
+			holding <- id
+			<-release
+			return nil
+		}, task.MediumPriority)
+		tsk.Require("license", 1)
+		if err := a.SubmitTask(tsk); err != nil {
+			t.Fatal("failed to submit task:", err)
+		}
+		tasks = append(tasks, tsk)
+	}
+
+	<-holding
+	select {
+	case id := <-holding:
+		t.Fatalf("task %s ran without the license", id)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	for _, tsk := range tasks {
+		if err := tsk.Wait(context.Background()); err != nil {
+			t.Fatal("failed to wait for task:", err)
+		}
+		if tsk.State() != task.Succeeded {
+			t.Errorf("expected succeeded state, got %s", tsk.State())
+		}
+	}
+}
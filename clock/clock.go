@@ -0,0 +1,121 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and runs functions after a delay. It allows time-based scheduling to be tested
+// without waiting for real time to pass.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine once d has elapsed, unless the returned timer is stopped first.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending call created by Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the call from happening, and returns false if it has already happened or been stopped.
+	Stop() bool
+}
+
+// realClock is a Clock backed by the time package.
+type realClock struct{}
+
+// Real returns a Clock that uses the system time.
+func Real() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// Fake is a Clock whose time only moves when it is advanced. Functions whose time has come are called
+// synchronously by Advance and Set, in the order they are due, rather than in their own goroutines.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake creates a Fake clock set to the given time.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the clock's current time.
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc calls f once the clock has been advanced by d.
+func (c *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, due: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, calling each function that becomes due.
+func (c *Fake) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to the given time, calling each function that becomes due. Functions scheduled
+// by those calls are also called if they become due by then. The clock never moves backwards.
+func (c *Fake) Set(now time.Time) {
+	for {
+		c.mu.Lock()
+		next := -1
+		for i, t := range c.timers {
+			if !t.due.After(now) && (next < 0 || t.due.Before(c.timers[next].due)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			if now.After(c.now) {
+				c.now = now
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		t := c.timers[next]
+		c.timers = append(c.timers[:next:next], c.timers[next+1:]...)
+		if t.due.After(c.now) {
+			c.now = t.due
+		}
+		c.mu.Unlock()
+		t.f()
+	}
+}
+
+// fakeTimer is a pending call on a Fake clock.
+type fakeTimer struct {
+	clock *Fake
+	due   time.Time
+	f     func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/clock"
+)
+
+func TestRealClock(t *testing.T) {
+	c := clock.Real()
+	assert.WithinDuration(t, time.Now(), c.Now(), time.Second)
+
+	fired := make(chan struct{})
+	c.AfterFunc(time.Millisecond, func() { close(fired) })
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire")
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("advance", func(t *testing.T) {
+		c := clock.NewFake(start)
+
+		var fired []string
+		c.AfterFunc(2*time.Second, func() { fired = append(fired, "second") })
+		c.AfterFunc(time.Second, func() { fired = append(fired, "first") })
+		c.AfterFunc(time.Minute, func() { fired = append(fired, "later") })
+
+		c.Advance(500 * time.Millisecond)
+		assert.Empty(t, fired)
+		assert.Equal(t, start.Add(500*time.Millisecond), c.Now())
+
+		c.Advance(2 * time.Second)
+		assert.Equal(t, []string{"first", "second"}, fired)
+		assert.Equal(t, start.Add(2500*time.Millisecond), c.Now())
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		c := clock.NewFake(start)
+
+		fired := false
+		timer := c.AfterFunc(time.Second, func() { fired = true })
+		assert.True(t, timer.Stop())
+		assert.False(t, timer.Stop())
+
+		c.Advance(time.Second)
+		assert.False(t, fired)
+	})
+
+	t.Run("timers scheduled while firing", func(t *testing.T) {
+		c := clock.NewFake(start)
+
+		var at []time.Time
+		c.AfterFunc(time.Second, func() {
+			at = append(at, c.Now())
+			c.AfterFunc(time.Second, func() { at = append(at, c.Now()) })
+		})
+
+		c.Set(start.Add(time.Minute))
+		assert.Equal(t, []time.Time{start.Add(time.Second), start.Add(2 * time.Second)}, at)
+		assert.Equal(t, start.Add(time.Minute), c.Now())
+	})
+}
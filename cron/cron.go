@@ -0,0 +1,286 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSchedule is returned when a cron expression cannot be parsed.
+var ErrInvalidSchedule = errors.New("invalid cron schedule")
+
+// Schedule describes when a recurring job runs.
+type Schedule interface {
+	// Next returns the first time the job runs after t, or the zero time if it never runs again.
+	Next(t time.Time) time.Time
+}
+
+// field describes the allowed values of one field of a cron expression.
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	seconds = field{name: "second", min: 0, max: 59}
+	minutes = field{name: "minute", min: 0, max: 59}
+	hours   = field{name: "hour", min: 0, max: 23}
+	days    = field{name: "day of month", min: 1, max: 31}
+	months  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	weekdays = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors are the predefined schedules that may be used in place of an expression.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression in the local time zone. See ParseInLocation.
+func Parse(expr string) (Schedule, error) {
+	return ParseInLocation(expr, time.Local)
+}
+
+// ParseInLocation parses a cron expression whose times are interpreted in loc. The expression has five
+// fields (minute, hour, day of month, month, day of week), or six with a leading seconds field. Each field
+// is *, a value, a range a-b, or a list of these separated by commas, optionally followed by a step /n.
+// Months and days of week may be given by their three-letter English names, and both 0 and 7 are Sunday.
+// When both day of month and day of week are restricted, a day matching either runs the job.
+// The descriptors @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly are also accepted,
+// and a leading CRON_TZ=<zone> or TZ=<zone> overrides loc.
+func ParseInLocation(expr string, loc *time.Location) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		i := strings.IndexAny(expr, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("%w: missing fields after time zone", ErrInvalidSchedule)
+		}
+		zone := expr[strings.Index(expr, "=")+1 : i]
+		var err error
+		if loc, err = time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+		expr = strings.TrimSpace(expr[i:])
+	}
+	if descriptor, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("%w: expected 5 or 6 fields, got %d", ErrInvalidSchedule, len(fields))
+	}
+
+	s := &cronSchedule{loc: loc}
+	var err error
+	specs := []struct {
+		bits *uint64
+		f    field
+	}{
+		{&s.second, seconds},
+		{&s.minute, minutes},
+		{&s.hour, hours},
+		{&s.dom, days},
+		{&s.month, months},
+		{&s.dow, weekdays},
+	}
+	for i, spec := range specs {
+		if *spec.bits, err = parseField(fields[i], spec.f); err != nil {
+			return nil, err
+		}
+	}
+	// Sunday may be written as 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.anyDom = fields[3] == "*" || fields[3] == "?"
+	s.anyDow = fields[5] == "*" || fields[5] == "?"
+	return s, nil
+}
+
+// parseField returns the set of values matched by one field of an expression, as a bit set.
+func parseField(expr string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		step, stepped := 1, false
+		if i := strings.Index(part, "/"); i >= 0 {
+			stepped = true
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("%w: invalid step %q in %s field", ErrInvalidSchedule, part[i+1:], f.name)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%w: empty range %q in %s field", ErrInvalidSchedule, part, f.name)
+			}
+		default:
+			var err error
+			if lo, err = parseValue(part, f); err != nil {
+				return 0, err
+			}
+			// A single value with a step runs from the value to the end of the field's range.
+			if !stepped {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseValue parses a single number or name in a field.
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%w: invalid value %q in %s field", ErrInvalidSchedule, s, f.name)
+	}
+	return v, nil
+}
+
+// cronSchedule is a Schedule parsed from a cron expression. Each field is a bit set of the values it matches.
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	anyDom, anyDow                        bool
+	loc                                   *time.Location
+}
+
+// Next returns the first time after t that matches the schedule, searching up to five years ahead.
+// Wall clock times skipped when clocks are set forward for daylight saving time never match. Wall clock
+// times repeated when clocks are set back only match the first time, unless the schedule matches every hour.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Second).Add(time.Second)
+	limit := t.Year() + 5
+
+	// Each field is advanced until it matches, resetting the smaller fields. Advancing a field past
+	// the end of its range carries into the larger fields, so the search starts again from the month.
+wrap:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+	// A daylight saving time change may skip the start of a day or hour, so the hour and minute are
+	// compared with the ones they started from to detect that they carried into the larger field.
+	for day := t.Day(); s.hour&(1<<uint(t.Hour())) == 0; {
+		t = nextHour(t)
+		if t.Day() != day {
+			goto wrap
+		}
+	}
+	for hour := t.Hour(); s.minute&(1<<uint(t.Minute())) == 0; {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Hour() != hour {
+			goto wrap
+		}
+	}
+	for s.second&(1<<uint(t.Second())) == 0 {
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+	if s.hour != everyHour && repeated(t) {
+		t = nextHour(t)
+		goto wrap
+	}
+	return t
+}
+
+// everyHour is the hour field of a schedule that matches every hour.
+const everyHour = 1<<24 - 1
+
+// nextHour returns the start of the hour after t. It moves forward in absolute time, so that an hour
+// skipped when clocks are set forward is passed over, and an hour repeated when they are set back is not.
+func nextHour(t time.Time) time.Time {
+	start := t.Add(-time.Duration(t.Minute())*time.Minute -
+		time.Duration(t.Second())*time.Second -
+		time.Duration(t.Nanosecond()))
+	return start.Add(time.Hour)
+}
+
+// repeated reports whether the wall clock time of t already occurred earlier the same day, because
+// clocks were set back in between.
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, earlier := t.Add(-24 * time.Hour).Zone()
+	back := time.Duration(earlier-offset) * time.Second
+	if back <= 0 {
+		return false
+	}
+	// The same wall clock time occurred back earlier if the earlier offset was still in effect then.
+	_, prior := t.Add(-back).Zone()
+	return prior == earlier
+}
+
+// dayMatches reports whether the day of t matches the schedule's day of month and day of week fields.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDom || s.anyDow {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// every is a Schedule that runs at a fixed interval.
+type every time.Duration
+
+// Every returns a Schedule that runs at a fixed interval, measured from the previous run.
+// It panics if interval is not positive.
+func Every(interval time.Duration) Schedule {
+	if interval <= 0 {
+		panic("cron: non-positive interval for Every")
+	}
+	return every(interval)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
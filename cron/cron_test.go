@@ -0,0 +1,140 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/cron"
+)
+
+func TestParse(t *testing.T) {
+	from := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC) // A Monday.
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 1, 16, 3, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * fri", time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jun-aug *", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * mon", time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 1,3", time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{"5/20 * * * * *", time.Date(2024, 1, 15, 10, 30, 5, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := cron.ParseInLocation(tt.expr, time.UTC)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.next, s.Next(from))
+		})
+	}
+
+	t.Run("time zone", func(t *testing.T) {
+		tokyo, err := time.LoadLocation("Asia/Tokyo")
+		if err != nil {
+			t.Skip("time zone database unavailable:", err)
+		}
+		s, err := cron.Parse("CRON_TZ=Asia/Tokyo 0 9 * * *")
+		assert.NoError(t, err)
+		next := s.Next(from)
+		assert.Equal(t, time.Date(2024, 1, 16, 9, 0, 0, 0, tokyo), next)
+		assert.Equal(t, time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC), next.UTC())
+	})
+
+	t.Run("daylight saving time", func(t *testing.T) {
+		load := func(name string) *time.Location {
+			loc, err := time.LoadLocation(name)
+			if err != nil {
+				t.Skip("time zone database unavailable:", err)
+			}
+			return loc
+		}
+		newYork, santiago, lordHowe := load("America/New_York"), load("America/Santiago"), load("Australia/Lord_Howe")
+		utc := func(month time.Month, day, hour, min int) time.Time {
+			return time.Date(2024, month, day, hour, min, 0, 0, time.UTC)
+		}
+
+		tests := []struct {
+			name string
+			loc  *time.Location
+			expr string
+			from time.Time
+			next []time.Time
+		}{
+			// Clocks are set forward from 02:00 EST (UTC-5) to 03:00 EDT (UTC-4) on 10 March 2024.
+			{"spring forward daily", newYork, "0 9 * * *", utc(time.March, 9, 15, 0),
+				[]time.Time{utc(time.March, 10, 13, 0), utc(time.March, 11, 13, 0)}},
+			{"spring forward skipped", newYork, "30 2 * * *", utc(time.March, 10, 5, 0),
+				[]time.Time{utc(time.March, 11, 6, 30)}},
+			{"spring forward hourly", newYork, "0 * * * *", utc(time.March, 10, 5, 30),
+				[]time.Time{utc(time.March, 10, 6, 0), utc(time.March, 10, 7, 0)}},
+			// Clocks are set back from 02:00 EDT to 01:00 EST on 3 November 2024.
+			{"fall back daily", newYork, "0 9 * * *", utc(time.November, 2, 14, 0),
+				[]time.Time{utc(time.November, 3, 14, 0), utc(time.November, 4, 14, 0)}},
+			{"fall back repeated", newYork, "30 1 * * *", utc(time.November, 3, 4, 0),
+				[]time.Time{utc(time.November, 3, 5, 30), utc(time.November, 4, 6, 30)}},
+			{"fall back hourly", newYork, "30 * * * *", utc(time.November, 3, 4, 45),
+				[]time.Time{utc(time.November, 3, 5, 30), utc(time.November, 3, 6, 30), utc(time.November, 3, 7, 30)}},
+			// Clocks are set forward from 00:00 CLT (UTC-4) to 01:00 CLST (UTC-3) on Sunday 8 September 2024.
+			{"spring forward skips midnight", santiago, "30 1 * * 6", utc(time.September, 7, 6, 0),
+				[]time.Time{utc(time.September, 14, 4, 30)}},
+			// Clocks are set forward from 02:00 LHST (UTC+10:30) to 02:30 LHDT (UTC+11) on 6 October 2024.
+			{"spring forward skips the start of an hour", lordHowe, "45 1 * * *", utc(time.October, 5, 15, 20),
+				[]time.Time{utc(time.October, 6, 14, 45)}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				s, err := cron.ParseInLocation(tt.expr, tt.loc)
+				assert.NoError(t, err)
+				next := tt.from
+				for _, want := range tt.next {
+					next = s.Next(next)
+					assert.True(t, want.Equal(next), "expected %s, got %s", want, next)
+				}
+			})
+		}
+	})
+
+	t.Run("never", func(t *testing.T) {
+		s, err := cron.ParseInLocation("0 0 30 2 *", time.UTC)
+		assert.NoError(t, err)
+		assert.True(t, s.Next(from).IsZero())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, expr := range []string{
+			"",
+			"* * * *",
+			"* * * * * * *",
+			"60 * * * *",
+			"* 24 * * *",
+			"* * 0 * *",
+			"* * * 13 *",
+			"* * * * 8",
+			"*/0 * * * *",
+			"5-1 * * * *",
+			"* * * foo *",
+			"CRON_TZ=Nowhere/Special * * * * *",
+		} {
+			_, err := cron.Parse(expr)
+			assert.ErrorIs(t, err, cron.ErrInvalidSchedule, expr)
+		}
+	})
+}
+
+func TestEvery(t *testing.T) {
+	from := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	assert.Equal(t, from.Add(90*time.Second), cron.Every(90*time.Second).Next(from))
+	assert.Panics(t, func() { cron.Every(0) })
+}
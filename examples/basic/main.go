@@ -38,7 +38,9 @@ func main() {
 		}
 
 		task := task.NewTask(fmt.Sprintf("task-%d", i), fn, task.MediumPriority)
-		a.SubmitTask(task)
+		if err := a.SubmitTask(task); err != nil {
+			fmt.Println("Task", i, "not submitted:", err)
+		}
 	}
 	time.Sleep(time.Second * 2)
 }
@@ -4,16 +4,24 @@ import (
 	"context"
 	"sync"
 
+	"github.com/CSXL/go-agent/clock"
 	"github.com/CSXL/go-agent/task"
 )
 
 // Executor is responsible for managing and executing tasks concurrently.
 type Executor struct {
 	taskQueue   chan *task.Task
+	mu          sync.Mutex
 	workerCount int
+	retire      []chan struct{}
+	started     bool
+	stopped     bool
 	wg          sync.WaitGroup
 	ctx         context.Context
 	cancel      context.CancelFunc
+	onComplete  func(*task.Task, error)
+	crash       bool
+	clock       clock.Clock
 }
 
 // NewExecutor creates a new Executor with the given number of workers.
@@ -28,31 +36,107 @@ func NewExecutor(workerCount int) *Executor {
 	}
 }
 
+// OnComplete registers a function that is called by a worker each time it finishes executing a task.
+// It must be called before Start.
+func (e *Executor) OnComplete(fn func(*task.Task, error)) {
+	e.onComplete = fn
+}
+
+// SetCrashOnPanic sets whether a panic in a task crashes the process instead of being recovered
+// and reported as a task.PanicError. It must be called before Start.
+func (e *Executor) SetCrashOnPanic(crash bool) {
+	e.crash = crash
+}
+
+// SetClock sets the clock that tasks check whether they have expired before starting against.
+// See task.WithClock. It must be called before Start.
+func (e *Executor) SetClock(c clock.Clock) {
+	e.clock = c
+}
+
+// CrashOnPanic returns true if a panic in a task crashes the process. See SetCrashOnPanic.
+func (e *Executor) CrashOnPanic() bool {
+	return e.crash
+}
+
+// WorkerCount returns the number of workers executing tasks.
+// Workers that are retiring after a Resize are not counted.
+func (e *Executor) WorkerCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.workerCount
+}
+
 // Start initializes the executor and starts the worker goroutines.
 func (e *Executor) Start() {
-	e.wg.Add(e.workerCount)
-	for i := 0; i < e.workerCount; i++ {
-		go e.worker()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.started = true
+	e.spawn(e.workerCount)
+}
+
+// Resize changes the number of workers to n. Values below 1 are treated as 1. New workers start immediately,
+// and removed workers exit once they have finished their current task, if any. Resize returns without waiting
+// for them to exit. Resizing an executor that has not been started sets the number of workers it starts with,
+// and resizing a stopped executor has no effect.
+func (e *Executor) Resize(n int) {
+	if n < 1 {
+		n = 1
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped {
+		return
+	}
+	if e.started {
+		if n > e.workerCount {
+			e.spawn(n - e.workerCount)
+		}
+		for i := n; i < e.workerCount; i++ {
+			// The most recently started workers retire first.
+			last := len(e.retire) - 1
+			close(e.retire[last])
+			e.retire = e.retire[:last]
+		}
+	}
+	e.workerCount = n
+}
+
+// spawn starts n workers. It must be called with e.mu held.
+func (e *Executor) spawn(n int) {
+	e.wg.Add(n)
+	for i := 0; i < n; i++ {
+		retire := make(chan struct{})
+		e.retire = append(e.retire, retire)
+		go e.worker(retire)
 	}
 }
 
-// Stop gracefully shuts down the executor and waits for all workers to finish.
+// Stop shuts down the executor, canceling the contexts of running tasks, and waits for all workers to finish.
+// Stopping an executor that has already stopped only waits for its workers.
 func (e *Executor) Stop() {
-	close(e.taskQueue)
+	e.closeQueue()
+	e.cancel()
 	e.wg.Wait()
 }
 
 // SoftStop gracefully shuts down the executor and waits for all workers to finish executing their current tasks.
+// Tasks are handed to workers directly, so none are left queued, and running tasks are not canceled.
 func (e *Executor) SoftStop() {
-	// Wait for the task queue to be empty.
-	for {
-		empty := len(e.taskQueue) == 0
-		if empty {
-			break
-		}
-	}
+	e.closeQueue()
+	e.wg.Wait()
 	e.cancel()
-	e.Stop()
+}
+
+// closeQueue stops the executor from accepting tasks, so that workers exit once they are idle.
+func (e *Executor) closeQueue() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped {
+		return
+	}
+	e.stopped = true
+	close(e.taskQueue)
 }
 
 // Submit adds a task to the executor's task queue for execution.
@@ -60,10 +144,35 @@ func (e *Executor) Submit(t *task.Task) {
 	e.taskQueue <- t
 }
 
-// worker represents a background goroutine that executes tasks.
-func (e *Executor) worker() {
+// worker represents a background goroutine that executes tasks, until the executor is stopped or retire is closed.
+func (e *Executor) worker(retire <-chan struct{}) {
 	defer e.wg.Done()
-	for t := range e.taskQueue {
-		_ = t.Execute(e.ctx)
+	ctx := e.ctx
+	if e.crash {
+		ctx = task.WithCrashOnPanic(ctx)
+	}
+	if e.clock != nil {
+		ctx = task.WithClock(ctx, e.clock)
+	}
+	for {
+		// A retired worker exits rather than taking another task, even if one is waiting.
+		select {
+		case <-retire:
+			return
+		default:
+		}
+		select {
+		case <-retire:
+			return
+		case t, ok := <-e.taskQueue:
+			if !ok {
+				return
+			}
+			// The outcome is also recorded on the task and retrieved through its Result.
+			err := t.Execute(ctx)
+			if e.onComplete != nil {
+				e.onComplete(t, err)
+			}
+		}
 	}
 }
@@ -2,10 +2,12 @@ package executor_test
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/CSXL/go-agent/clock"
 	"github.com/CSXL/go-agent/executor"
 	"github.com/CSXL/go-agent/task"
 	"github.com/stretchr/testify/assert"
@@ -25,11 +27,49 @@ func TestExecutorStartStop(t *testing.T) {
 	// Ensure that the executor can be started and stopped without any issues.
 }
 
+func TestExecutorStopTwice(t *testing.T) {
+	ex := executor.NewExecutor(4)
+	ex.Start()
+
+	// Stopping an executor that has already stopped does not panic.
+	ex.SoftStop()
+	ex.Stop()
+	ex.SoftStop()
+}
+
+func TestExecutorStopCancelsRunningTasks(t *testing.T) {
+	ex := executor.NewExecutor(1)
+	ex.Start()
+
+	started := make(chan struct{})
+	tsk := task.NewTask("test_task", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, task.LowPriority)
+	ex.Submit(tsk)
+	<-started
+
+	ex.Stop()
+
+	assert.True(t, tsk.State().IsTerminal())
+	assert.ErrorIs(t, tsk.Err(), context.Canceled)
+}
+
 func TestExecutorSoftStop(t *testing.T) {
 	ex := executor.NewExecutor(4)
 	ex.Start()
 
+	tsk := task.NewTask("test_task", func(ctx context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		return ctx.Err()
+	}, task.LowPriority)
+	ex.Submit(tsk)
+
 	ex.SoftStop()
+
+	// The running task finishes without being canceled before SoftStop returns.
+	assert.Equal(t, task.Succeeded, tsk.State())
 }
 
 func TestExecutorSubmit(t *testing.T) {
@@ -54,3 +94,124 @@ func TestExecutorSubmit(t *testing.T) {
 
 	// Ensure that the submitted tasks are executed by the executor.
 }
+
+func TestExecutorOnComplete(t *testing.T) {
+	ex := executor.NewExecutor(1)
+
+	completed := make(chan error, 1)
+	ex.OnComplete(func(tsk *task.Task, err error) {
+		completed <- err
+	})
+	ex.Start()
+	defer ex.Stop()
+
+	expectedErr := errors.New("task failed")
+	ex.Submit(task.NewTask("test_task", func(ctx context.Context) error {
+		return expectedErr
+	}, task.LowPriority))
+
+	assert.Equal(t, expectedErr, <-completed)
+}
+
+func TestExecutorPanic(t *testing.T) {
+	ex := executor.NewExecutor(1)
+	ex.Start()
+	defer ex.Stop()
+
+	panicking := task.NewTask("panicking", func(ctx context.Context) error {
+		panic("boom")
+	}, task.LowPriority)
+	ex.Submit(panicking)
+
+	// The worker must survive the panic to execute the next task.
+	tsk := task.NewTask("test_task", func(ctx context.Context) error {
+		return nil
+	}, task.LowPriority)
+	ex.Submit(tsk)
+
+	assert.NoError(t, tsk.Wait(context.Background()))
+	var panicErr *task.PanicError
+	assert.ErrorAs(t, panicking.Err(), &panicErr)
+}
+
+func TestExecutorClock(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ex := executor.NewExecutor(1)
+	ex.SetClock(c)
+	ex.Start()
+	defer ex.Stop()
+
+	tsk := task.NewTask("test_task", func(ctx context.Context) error { return nil }, task.LowPriority)
+	tsk.SetTimeout(time.Millisecond)
+	tsk.SetExpireBeforeStart(true)
+	assert.NoError(t, tsk.MarkSubmittedAt(c.Now()))
+	time.Sleep(10 * time.Millisecond)
+
+	// The task has not expired by the executor's clock, however much time has really passed.
+	ex.Submit(tsk)
+	assert.NoError(t, tsk.Wait(context.Background()))
+	assert.Equal(t, task.Succeeded, tsk.State())
+}
+
+func TestExecutorCrashOnPanic(t *testing.T) {
+	ex := executor.NewExecutor(1)
+	assert.False(t, ex.CrashOnPanic())
+	ex.SetCrashOnPanic(true)
+	assert.True(t, ex.CrashOnPanic())
+}
+
+func TestExecutorResize(t *testing.T) {
+	ex := executor.NewExecutor(1)
+	ex.Start()
+	defer ex.Stop()
+
+	started := make(chan string, 4)
+	release := make(chan struct{})
+	newTask := func(id string) *task.Task {
+		return task.NewTask(id, func(ctx context.Context) error {
+			started <- id
+			<-release
+			return nil
+		}, task.LowPriority)
+	}
+	expectNone := func(t *testing.T) {
+		select {
+		case id := <-started:
+			t.Fatalf("task %s started unexpectedly", id)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	t.Run("grow", func(t *testing.T) {
+		ex.Submit(newTask("first"))
+		assert.Equal(t, "first", <-started)
+
+		// The new worker receives the task immediately.
+		ex.Resize(2)
+		assert.Equal(t, 2, ex.WorkerCount())
+		ex.Submit(newTask("second"))
+		assert.Equal(t, "second", <-started)
+	})
+
+	t.Run("shrink", func(t *testing.T) {
+		// Running tasks complete before their workers exit.
+		ex.Resize(0)
+		assert.Equal(t, 1, ex.WorkerCount())
+		release <- struct{}{}
+		release <- struct{}{}
+
+		submitted := make(chan struct{})
+		go func() {
+			ex.Submit(newTask("third"))
+			ex.Submit(newTask("fourth"))
+			close(submitted)
+		}()
+		assert.Equal(t, "third", <-started)
+		expectNone(t)
+
+		release <- struct{}{}
+		assert.Equal(t, "fourth", <-started)
+		release <- struct{}{}
+		<-submitted
+	})
+}
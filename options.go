@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/scheduler"
+)
+
+// Option configures an Agent.
+type Option func(*options)
+
+// options holds the configuration of an Agent.
+type options struct {
+	crashOnPanic  bool
+	queueCapacity int
+	overflow      scheduler.OverflowPolicy
+	aging         time.Duration
+	groupWeights  map[string]int
+	rateLimits    map[string]scheduler.RateLimit
+	clock         clock.Clock
+	policy        func() scheduler.Policy
+	preemptions   int
+	idempotency   time.Duration
+	autoscale     scheduler.Autoscale
+	retention     int
+}
+
+// WithCrashOnPanic makes a panic in a task crash the process with its original stack trace,
+// instead of being recovered and reported as a task.PanicError. It is intended for debugging.
+func WithCrashOnPanic() Option {
+	return func(o *options) {
+		o.crashOnPanic = true
+	}
+}
+
+// WithQueueLimit limits the number of submitted tasks that may be waiting to start,
+// and sets how submissions beyond that limit are handled.
+func WithQueueLimit(capacity int, policy scheduler.OverflowPolicy) Option {
+	return func(o *options) {
+		o.queueCapacity = capacity
+		o.overflow = policy
+	}
+}
+
+// WithAging raises the effective priority of queued tasks by one for every interval they have waited,
+// so that low-priority tasks eventually run under sustained high-priority load.
+func WithAging(interval time.Duration) Option {
+	return func(o *options) {
+		o.aging = interval
+	}
+}
+
+// WithGroupWeight sets the weight of a group of tasks, so that groups with tasks of the same priority
+// share workers in proportion to their weights. It may be given once per group.
+func WithGroupWeight(group string, weight int) Option {
+	return func(o *options) {
+		if o.groupWeights == nil {
+			o.groupWeights = make(map[string]int)
+		}
+		o.groupWeights[group] = weight
+	}
+}
+
+// WithRateLimit limits how often the tasks of a group are dispatched. It may be given once per group.
+func WithRateLimit(group string, limit scheduler.RateLimit) Option {
+	return func(o *options) {
+		if o.rateLimits == nil {
+			o.rateLimits = make(map[string]scheduler.RateLimit)
+		}
+		o.rateLimits[group] = limit
+	}
+}
+
+// WithClock sets the clock used to time delayed tasks and retries, e.g. a clock.Fake in tests.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithPolicy sets the scheduling policy that orders each group's ready tasks, e.g. scheduler.NewFIFOPolicy
+// or scheduler.NewEDFPolicy. The default is scheduler.NewPriorityPolicy.
+func WithPolicy(newPolicy func() scheduler.Policy) Option {
+	return func(o *options) {
+		o.policy = newPolicy
+	}
+}
+
+// WithPreemption lets higher-priority tasks preempt running preemptible tasks when every worker is busy.
+// Preempted tasks are queued again, and each task is preempted at most maxPreemptions times.
+// See task.Task.SetPreemptible.
+func WithPreemption(maxPreemptions int) Option {
+	return func(o *options) {
+		o.preemptions = maxPreemptions
+	}
+}
+
+// WithIdempotencyWindow makes tasks submitted with the idempotency key of a task that completed less than
+// window ago share its outcome instead of running. Tasks submitted while one with the same key has not
+// completed always share its outcome. See task.Task.SetIdempotencyKey.
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(o *options) {
+		o.idempotency = window
+	}
+}
+
+// WithAutoscale adjusts the number of workers to the load, within the configuration's bounds.
+// See scheduler.Scheduler.SetAutoscale.
+func WithAutoscale(cfg scheduler.Autoscale) Option {
+	return func(o *options) {
+		o.autoscale = cfg
+	}
+}
+
+// WithRetention sets how many of the most recently completed tasks remain known to the agent, e.g. through
+// Result. It defaults to scheduler.DefaultRetention. See scheduler.Scheduler.SetRetention.
+func WithRetention(n int) Option {
+	return func(o *options) {
+		o.retention = n
+	}
+}
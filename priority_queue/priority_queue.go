@@ -2,23 +2,38 @@ package priority_queue
 
 import (
 	"container/heap"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/CSXL/go-agent/clock"
 	"github.com/CSXL/go-agent/task"
 )
 
-// PriorityQueue represents a task priority queue.
+// PriorityQueue represents a task priority queue. Tasks are ordered by their effective priority,
+// and tasks of equal priority are ordered by the time they were pushed. Without aging, a task's
+// effective priority is its priority; with aging, it grows the longer the task waits.
+//
+// PriorityQueue keeps itself ordered, so Push and Pop are used directly rather than through
+// container/heap. It does not implement heap.Interface.
 type PriorityQueue struct {
-	items []*task.Task
+	items taskHeap
+	seq   uint64
+	aging time.Duration
+	clock clock.Clock
+	epoch time.Time
 	mu    sync.Mutex
 }
 
 // NewPriorityQueue creates a new PriorityQueue.
 func NewPriorityQueue() *PriorityQueue {
+	c := clock.Real()
 	pq := &PriorityQueue{
-		items: make([]*task.Task, 0),
+		items: taskHeap{index: make(map[*task.Task]int)},
+		clock: c,
+		epoch: c.Now(),
 	}
-	heap.Init(pq)
+	heap.Init(&pq.items)
 	return pq
 }
 
@@ -36,78 +51,187 @@ func (pq *PriorityQueue) releaseLock() {
 func (pq *PriorityQueue) Len() int {
 	pq.acquireLock()
 	defer pq.releaseLock()
-	return len(pq.items)
+	return pq.items.Len()
 }
 
-// Less compares the priority of two tasks in the priority queue.
-func (pq *PriorityQueue) Less(i, j int) bool {
+// Push adds a task to the priority queue. Pushing a task that is already queued has no effect.
+func (pq *PriorityQueue) Push(x interface{}) {
 	pq.acquireLock()
 	defer pq.releaseLock()
-	return pq.items[i].Priority() > pq.items[j].Priority()
+	t := x.(*task.Task)
+	if _, queued := pq.items.index[t]; queued {
+		return
+	}
+	pq.seq++
+	it := &item{task: t, priority: t.Priority(), pushedAt: pq.clock.Now(), seq: pq.seq}
+	it.key = pq.key(it)
+	heap.Push(&pq.items, it)
 }
 
-// Swap swaps two tasks in the priority queue.
-func (pq *PriorityQueue) Swap(i, j int) {
+// Pop removes and returns the highest-priority task from the priority queue, or nil if it is empty.
+func (pq *PriorityQueue) Pop() interface{} {
 	pq.acquireLock()
 	defer pq.releaseLock()
-	pq.items[i], pq.items[j] = pq.items[j], pq.items[i]
+	if pq.items.Len() == 0 {
+		return nil
+	}
+	return heap.Pop(&pq.items).(*item).task
 }
 
-// Push adds an item to the priority queue.
-func (pq *PriorityQueue) Push(x interface{}) {
+// Peek returns the highest-priority item from the priority queue without removing it.
+func (pq *PriorityQueue) Peek() *task.Task {
 	pq.acquireLock()
 	defer pq.releaseLock()
-	pq.items = append(pq.items, x.(*task.Task))
+	if pq.items.Len() == 0 {
+		return nil
+	}
+	return pq.items.items[0].task
 }
 
-// Pop removes the highest-priority item from the priority queue.
-func (pq *PriorityQueue) Pop() interface{} {
+// Contains returns true if the task is in the priority queue.
+func (pq *PriorityQueue) Contains(t *task.Task) bool {
 	pq.acquireLock()
 	defer pq.releaseLock()
-	old := pq.items
-	n := len(old)
-	item := old[n-1]
-	pq.items = old[0 : n-1]
-	return item
+	_, queued := pq.items.index[t]
+	return queued
 }
 
-// Peek returns the highest-priority item from the priority queue without removing it.
-func (pq *PriorityQueue) Peek() *task.Task {
+// Tasks returns the tasks in the priority queue in the order they were pushed.
+func (pq *PriorityQueue) Tasks() []*task.Task {
+	pq.acquireLock()
+	items := append([]*item(nil), pq.items.items...)
+	pq.releaseLock()
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].seq < items[j].seq
+	})
+	tasks := make([]*task.Task, len(items))
+	for i, it := range items {
+		tasks[i] = it.task
+	}
+	return tasks
+}
+
+// Remove removes a specific task from the priority queue, and returns false if it was not queued.
+func (pq *PriorityQueue) Remove(t *task.Task) bool {
 	pq.acquireLock()
 	defer pq.releaseLock()
-	if len(pq.items) == 0 {
-		return nil
+	i, queued := pq.items.index[t]
+	if !queued {
+		return false
 	}
-	n := len(pq.items) - 1
-	item := pq.items[n]
-	return item
+	heap.Remove(&pq.items, i)
+	return true
 }
 
-// Remove removes a specific task from the priority queue.
-func (pq *PriorityQueue) Remove(t *task.Task) {
-	pq.mu.Lock()
-	defer pq.mu.Unlock()
-	for i, item := range pq.items {
-		if item.ID() == t.ID() {
-			pq.mu.Unlock() // Unlock the mutex before calling heap.Remove
-			heap.Remove(pq, i)
-			pq.mu.Lock() // Lock the mutex again after heap.Remove is done
-			break
-		}
+// UpdatePriority updates the priority of a specific task in the priority queue, and returns false if it was not queued.
+func (pq *PriorityQueue) UpdatePriority(t *task.Task, newPriority task.Priority) bool {
+	pq.acquireLock()
+	defer pq.releaseLock()
+	i, queued := pq.items.index[t]
+	if !queued {
+		return false
 	}
+	t.SetPriority(newPriority)
+	it := pq.items.items[i]
+	it.priority = newPriority
+	it.key = pq.key(it)
+	heap.Fix(&pq.items, i)
+	return true
 }
 
-// UpdatePriority updates the priority of a specific task in the priority queue.
-func (pq *PriorityQueue) UpdatePriority(t *task.Task, newPriority task.Priority) {
-	pq.mu.Lock()
-	defer pq.mu.Unlock()
-	for i, item := range pq.items {
-		if item.ID() == t.ID() {
-			item.SetPriority(newPriority)
-			pq.mu.Unlock() // Unlock the mutex before calling heap.Fix
-			heap.Fix(pq, i)
-			pq.mu.Lock() // Lock the mutex again after heap.Fix is done
-			break
-		}
+// SetAging raises the effective priority of queued tasks by one for every interval they have waited,
+// so that low-priority tasks are not starved by a steady stream of higher-priority ones.
+// An interval of zero or less disables aging.
+func (pq *PriorityQueue) SetAging(interval time.Duration) {
+	pq.acquireLock()
+	defer pq.releaseLock()
+	pq.aging = interval
+	for _, it := range pq.items.items {
+		it.key = pq.key(it)
 	}
+	heap.Init(&pq.items)
+}
+
+// SetClock sets the clock that measures how long tasks have waited for aging. It must be called before any
+// tasks are pushed.
+func (pq *PriorityQueue) SetClock(c clock.Clock) {
+	pq.acquireLock()
+	defer pq.releaseLock()
+	pq.clock = c
+	pq.epoch = c.Now()
+}
+
+// EffectivePriority returns the priority a queued task is currently ordered by,
+// and false if it is not queued.
+func (pq *PriorityQueue) EffectivePriority(t *task.Task) (task.Priority, bool) {
+	pq.acquireLock()
+	defer pq.releaseLock()
+	i, queued := pq.items.index[t]
+	if !queued {
+		return 0, false
+	}
+	it := pq.items.items[i]
+	if pq.aging <= 0 {
+		return it.priority, true
+	}
+	return it.priority + task.Priority(pq.clock.Now().Sub(it.pushedAt)/pq.aging), true
+}
+
+// key returns the value it is ordered by. With aging, every task's effective priority grows at the
+// same rate, so ordering by priority less the time of pushing, in intervals, is the same as ordering
+// by effective priority at any moment, and the order never needs to be recomputed as time passes.
+func (pq *PriorityQueue) key(it *item) float64 {
+	if pq.aging <= 0 {
+		return float64(it.priority)
+	}
+	return float64(it.priority) - float64(it.pushedAt.Sub(pq.epoch))/float64(pq.aging)
+}
+
+// item is a task in the priority queue, along with the priority it is ordered by.
+type item struct {
+	task     *task.Task
+	priority task.Priority
+	pushedAt time.Time
+	key      float64
+	seq      uint64
+}
+
+// taskHeap implements heap.Interface for items, keeping track of each task's position.
+type taskHeap struct {
+	items []*item
+	index map[*task.Task]int
+}
+
+func (h *taskHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *taskHeap) Less(i, j int) bool {
+	if h.items[i].key != h.items[j].key {
+		return h.items[i].key > h.items[j].key
+	}
+	return h.items[i].seq < h.items[j].seq
+}
+
+func (h *taskHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i].task] = i
+	h.index[h.items[j].task] = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	it := x.(*item)
+	h.index[it.task] = len(h.items)
+	h.items = append(h.items, it)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := h.items
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	h.items = old[0 : n-1]
+	delete(h.index, it.task)
+	return it
 }
@@ -3,7 +3,9 @@ package priority_queue_test
 
 import (
 	"testing"
+	"time"
 
+	"github.com/CSXL/go-agent/clock"
 	"github.com/CSXL/go-agent/priority_queue"
 	"github.com/CSXL/go-agent/task"
 	"github.com/stretchr/testify/assert"
@@ -39,3 +41,117 @@ func TestPriorityQueue(t *testing.T) {
 	assert.Equal(t, "task2", updatedTask.ID())
 	assert.Equal(t, task.HighPriority, updatedTask.Priority())
 }
+
+func TestPriorityQueueOrdering(t *testing.T) {
+	t.Run("priority then arrival", func(t *testing.T) {
+		pq := priority_queue.NewPriorityQueue()
+
+		for i, p := range []task.Priority{task.LowPriority, task.HighPriority, task.MediumPriority, task.HighPriority, task.LowPriority} {
+			pq.Push(task.NewTask(string(rune('a'+i)), nil, p))
+		}
+
+		var order []string
+		for pq.Len() > 0 {
+			order = append(order, pq.Pop().(*task.Task).ID())
+		}
+		assert.Equal(t, []string{"b", "d", "c", "a", "e"}, order)
+		assert.Nil(t, pq.Pop())
+		assert.Nil(t, pq.Peek())
+	})
+
+	t.Run("duplicate IDs", func(t *testing.T) {
+		pq := priority_queue.NewPriorityQueue()
+
+		first := task.NewTask("same", nil, task.LowPriority)
+		second := task.NewTask("same", nil, task.HighPriority)
+		pq.Push(first)
+		pq.Push(second)
+		pq.Push(second)
+
+		assert.Equal(t, 2, pq.Len())
+		assert.True(t, pq.Remove(first))
+		assert.False(t, pq.Remove(first))
+		assert.False(t, pq.Contains(first))
+		assert.True(t, pq.Contains(second))
+		assert.Equal(t, second, pq.Pop())
+	})
+
+	t.Run("update unqueued", func(t *testing.T) {
+		pq := priority_queue.NewPriorityQueue()
+		tsk := task.NewTask("task", nil, task.LowPriority)
+
+		assert.False(t, pq.UpdatePriority(tsk, task.HighPriority))
+		assert.Equal(t, task.LowPriority, tsk.Priority())
+	})
+}
+
+func TestPriorityQueueTasks(t *testing.T) {
+	pq := priority_queue.NewPriorityQueue()
+
+	low := task.NewTask("low", nil, task.LowPriority)
+	high := task.NewTask("high", nil, task.HighPriority)
+	medium := task.NewTask("medium", nil, task.MediumPriority)
+	pq.Push(low)
+	pq.Push(high)
+	pq.Push(medium)
+
+	assert.Equal(t, []*task.Task{low, high, medium}, pq.Tasks())
+	assert.Equal(t, 3, pq.Len())
+}
+
+func TestPriorityQueueAging(t *testing.T) {
+	t.Run("numeric priorities", func(t *testing.T) {
+		pq := priority_queue.NewPriorityQueue()
+
+		between := task.NewTask("between", nil, task.MediumPriority+1)
+		medium := task.NewTask("medium", nil, task.MediumPriority)
+		negative := task.NewTask("negative", nil, -1)
+		pq.Push(negative)
+		pq.Push(medium)
+		pq.Push(between)
+
+		assert.Equal(t, between, pq.Pop())
+		assert.Equal(t, medium, pq.Pop())
+		assert.Equal(t, negative, pq.Pop())
+	})
+
+	t.Run("waiting tasks overtake", func(t *testing.T) {
+		c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		pq := priority_queue.NewPriorityQueue()
+		pq.SetClock(c)
+		pq.SetAging(time.Second)
+
+		low := task.NewTask("low", nil, task.LowPriority)
+		pq.Push(low)
+		c.Advance(101 * time.Second)
+		high := task.NewTask("high", nil, task.HighPriority)
+		pq.Push(high)
+
+		priority, queued := pq.EffectivePriority(low)
+		assert.True(t, queued)
+		assert.Equal(t, task.LowPriority+101, priority)
+		assert.Equal(t, low, pq.Pop())
+		assert.Equal(t, high, pq.Pop())
+
+		_, queued = pq.EffectivePriority(low)
+		assert.False(t, queued)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		pq := priority_queue.NewPriorityQueue()
+		pq.SetClock(c)
+		pq.SetAging(time.Second)
+
+		low := task.NewTask("low", nil, task.LowPriority)
+		pq.Push(low)
+		c.Advance(101 * time.Second)
+		high := task.NewTask("high", nil, task.HighPriority)
+		pq.Push(high)
+		pq.SetAging(0)
+
+		priority, _ := pq.EffectivePriority(low)
+		assert.Equal(t, task.LowPriority, priority)
+		assert.Equal(t, high, pq.Pop())
+	})
+}
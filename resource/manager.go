@@ -2,12 +2,34 @@ package resource
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 )
 
+var (
+	// ErrResourceExists is returned when a resource is registered under a name that is already in use.
+	ErrResourceExists = errors.New("resource already registered")
+
+	// ErrResourceNotFound is returned when a name does not match any registered resource.
+	ErrResourceNotFound = errors.New("resource not found")
+
+	// ErrExceedsCapacity is returned when more units of a resource are requested than it has.
+	ErrExceedsCapacity = errors.New("request exceeds resource capacity")
+)
+
+// Request is a number of units of a named resource.
+type Request struct {
+	// Name is the name the resource is registered under.
+	Name string
+
+	// Units is the number of units requested. Values below 1 are treated as 1.
+	Units int
+}
+
 // Manager is responsible for managing shared resources among concurrent tasks.
 type Manager struct {
 	resources map[string]Resource
+	onRelease func()
 	mu        sync.Mutex
 }
 
@@ -21,26 +43,26 @@ func NewManager() *Manager {
 // Register registers a shared resource with the Manager.
 func (m *Manager) Register(name string, res Resource) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	if _, exists := m.resources[name]; exists {
-		return errors.New("resource already registered")
+		m.mu.Unlock()
+		return ErrResourceExists
 	}
 
 	m.resources[name] = res
+	m.unlockAndNotify()
 	return nil
 }
 
 // Unregister removes a shared resource from the Manager.
 func (m *Manager) Unregister(name string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	if _, exists := m.resources[name]; !exists {
-		return errors.New("resource not found")
+		m.mu.Unlock()
+		return ErrResourceNotFound
 	}
 
 	delete(m.resources, name)
+	m.unlockAndNotify()
 	return nil
 }
 
@@ -51,7 +73,7 @@ func (m *Manager) Allocate(name string) error {
 
 	res, exists := m.resources[name]
 	if !exists {
-		return errors.New("resource not found")
+		return ErrResourceNotFound
 	}
 
 	return res.Allocate()
@@ -60,12 +82,127 @@ func (m *Manager) Allocate(name string) error {
 // Deallocate releases the specified resource previously reserved by a task.
 func (m *Manager) Deallocate(name string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	res, exists := m.resources[name]
 	if !exists {
-		return errors.New("resource not found")
+		m.mu.Unlock()
+		return ErrResourceNotFound
+	}
+
+	if err := res.Deallocate(); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.unlockAndNotify()
+	return nil
+}
+
+// Registered returns true if a resource is registered under the given name.
+func (m *Manager) Registered(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.resources[name]
+	return exists
+}
+
+// Satisfiable checks that the requests could be satisfied once the resources are free: that every requested
+// resource is registered, and that no more units of each Bounded resource are requested than its capacity.
+func (m *Manager) Satisfiable(requests []Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requested := make(map[string]int)
+	for _, req := range requests {
+		res, exists := m.resources[req.Name]
+		if !exists {
+			return fmt.Errorf("%w: %q", ErrResourceNotFound, req.Name)
+		}
+		requested[req.Name] += units(req)
+		if bounded, ok := res.(Bounded); ok && requested[req.Name] > bounded.Capacity() {
+			return fmt.Errorf("%w: %d units of %q requested, capacity %d",
+				ErrExceedsCapacity, requested[req.Name], req.Name, bounded.Capacity())
+		}
+	}
+	return nil
+}
+
+// AcquireAll reserves every requested unit of every requested resource, or none of them:
+// if any unit cannot be allocated, the units already allocated are released and the error is returned.
+func (m *Manager) AcquireAll(requests []Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var acquired []Resource
+	for _, req := range requests {
+		res, exists := m.resources[req.Name]
+		if !exists {
+			m.rollback(acquired)
+			return fmt.Errorf("%w: %q", ErrResourceNotFound, req.Name)
+		}
+		for i := 0; i < units(req); i++ {
+			if err := res.Allocate(); err != nil {
+				m.rollback(acquired)
+				return fmt.Errorf("resource %q: %w", req.Name, err)
+			}
+			acquired = append(acquired, res)
+		}
+	}
+	return nil
+}
+
+// ReleaseAll releases every requested unit of every requested resource, previously reserved with AcquireAll.
+// It releases as many units as it can, and returns the errors from any it could not.
+func (m *Manager) ReleaseAll(requests []Request) error {
+	m.mu.Lock()
+	var errs []error
+	for _, req := range requests {
+		res, exists := m.resources[req.Name]
+		if !exists {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrResourceNotFound, req.Name))
+			continue
+		}
+		for i := 0; i < units(req); i++ {
+			if err := res.Deallocate(); err != nil {
+				errs = append(errs, fmt.Errorf("resource %q: %w", req.Name, err))
+				break
+			}
+		}
 	}
+	m.unlockAndNotify()
+	return errors.Join(errs...)
+}
+
+// OnRelease sets a function to be called whenever resources may have become available, i.e. after a resource
+// is registered or deallocated, or whether requests can be satisfied may have changed, i.e. after a resource is
+// unregistered. It is called without the Manager's lock held, before the call that released
+// the resources returns.
+func (m *Manager) OnRelease(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return res.Deallocate()
+	m.onRelease = fn
+}
+
+// unlockAndNotify releases m.mu and then calls the release hook, if any.
+func (m *Manager) unlockAndNotify() {
+	onRelease := m.onRelease
+	m.mu.Unlock()
+	if onRelease != nil {
+		onRelease()
+	}
+}
+
+// rollback releases the given units, in reverse order. It must be called with m.mu held.
+func (m *Manager) rollback(acquired []Resource) {
+	for i := len(acquired) - 1; i >= 0; i-- {
+		_ = acquired[i].Deallocate()
+	}
+}
+
+// units returns the number of units requested by req.
+func units(req Request) int {
+	if req.Units < 1 {
+		return 1
+	}
+	return req.Units
 }
@@ -58,4 +58,55 @@ func TestManager(t *testing.T) {
 
 		wg.Wait()
 	})
+
+	t.Run("acquire and release all", func(t *testing.T) {
+		m := resource.NewManager()
+		assert.NoError(t, m.Register("gpu", resource.NewSemaphore(2)))
+		assert.NoError(t, m.Register("db", resource.NewSemaphore(1)))
+
+		released := 0
+		m.OnRelease(func() { released++ })
+
+		requests := []resource.Request{{Name: "gpu", Units: 2}, {Name: "db", Units: 1}}
+		assert.NoError(t, m.AcquireAll(requests))
+		assert.Error(t, m.AcquireAll([]resource.Request{{Name: "gpu", Units: 1}}))
+
+		assert.NoError(t, m.ReleaseAll(requests))
+		assert.Equal(t, 1, released)
+		assert.NoError(t, m.AcquireAll(requests))
+	})
+
+	t.Run("acquire all rolls back", func(t *testing.T) {
+		m := resource.NewManager()
+		assert.NoError(t, m.Register("gpu", resource.NewSemaphore(2)))
+		assert.NoError(t, m.Register("db", resource.NewSemaphore(1)))
+		assert.NoError(t, m.Allocate("db"))
+
+		err := m.AcquireAll([]resource.Request{{Name: "gpu", Units: 2}, {Name: "db", Units: 1}})
+		assert.Error(t, err)
+
+		// The units of gpu allocated before db failed were released.
+		assert.NoError(t, m.AcquireAll([]resource.Request{{Name: "gpu", Units: 2}}))
+
+		err = m.AcquireAll([]resource.Request{{Name: "missing", Units: 1}})
+		assert.ErrorIs(t, err, resource.ErrResourceNotFound)
+		assert.False(t, m.Registered("missing"))
+		assert.True(t, m.Registered("gpu"))
+	})
+
+	t.Run("satisfiable", func(t *testing.T) {
+		m := resource.NewManager()
+		assert.NoError(t, m.Register("gpu", resource.NewSemaphore(2)))
+		assert.NoError(t, m.Allocate("gpu"))
+		assert.NoError(t, m.Allocate("gpu"))
+
+		// Capacity is checked regardless of the units currently allocated.
+		assert.NoError(t, m.Satisfiable([]resource.Request{{Name: "gpu", Units: 2}}))
+		err := m.Satisfiable([]resource.Request{{Name: "gpu", Units: 3}})
+		assert.ErrorIs(t, err, resource.ErrExceedsCapacity)
+		err = m.Satisfiable([]resource.Request{{Name: "gpu", Units: 1}, {Name: "gpu", Units: 2}})
+		assert.ErrorIs(t, err, resource.ErrExceedsCapacity)
+		err = m.Satisfiable([]resource.Request{{Name: "missing", Units: 1}})
+		assert.ErrorIs(t, err, resource.ErrResourceNotFound)
+	})
 }
@@ -8,3 +8,12 @@ type Resource interface {
 	// Deallocate releases the resource previously reserved by a task.
 	Deallocate() error
 }
+
+// Bounded is a Resource with a fixed number of units, which can be allocated at once.
+// Requests for more units than its capacity can never be satisfied.
+type Bounded interface {
+	Resource
+
+	// Capacity returns the number of units of the resource.
+	Capacity() int
+}
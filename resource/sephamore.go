@@ -20,6 +20,11 @@ func NewSemaphore(maxCount int) *Semaphore {
 	}
 }
 
+// Capacity returns the maximum count of the semaphore.
+func (s *Semaphore) Capacity() int {
+	return s.maxCount
+}
+
 // Allocate reserves a slot in the semaphore, blocking if the maximum count is reached.
 func (s *Semaphore) Allocate() error {
 	s.mu.Lock()
@@ -29,6 +29,11 @@ func TestSemaphore(t *testing.T) {
 		assert.Error(t, err)
 	})
 
+	t.Run("capacity", func(t *testing.T) {
+		sem := resource.NewSemaphore(3)
+		assert.Equal(t, 3, sem.Capacity())
+	})
+
 	t.Run("no slots to release", func(t *testing.T) {
 		sem := resource.NewSemaphore(1)
 
@@ -0,0 +1,306 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/CSXL/go-agent/task"
+)
+
+var (
+	// ErrQueueFull is returned when a task cannot be submitted because the scheduler has no room for it.
+	ErrQueueFull = errors.New("scheduler queue is full")
+
+	// ErrDropped is the cause recorded for queued tasks evicted to make room for newer submissions.
+	ErrDropped = errors.New("task dropped from full queue")
+)
+
+// OverflowPolicy determines what happens when a task is submitted to a scheduler whose queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until there is room for the task, or the submission's context is done.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowFailFast rejects the task with ErrQueueFull.
+	OverflowFailFast
+
+	// OverflowDropOldest cancels the longest-queued tasks with ErrDropped to make room for the task.
+	OverflowDropOldest
+
+	// OverflowDropLowest cancels the lowest-priority queued tasks with ErrDropped to make room for the task.
+	// If no queued task has a lower priority than the task being submitted, the task is rejected with ErrQueueFull.
+	OverflowDropLowest
+
+	// OverflowCallerRuns executes the task in the submitting goroutine instead of queuing it.
+	// Graphs, and tasks whose dependencies have not completed, are rejected with ErrQueueFull.
+	OverflowCallerRuns
+)
+
+// String returns the name of the overflow policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowFailFast:
+		return "fail fast"
+	case OverflowDropOldest:
+		return "drop oldest"
+	case OverflowDropLowest:
+		return "drop lowest"
+	case OverflowCallerRuns:
+		return "caller runs"
+	default:
+		return "unknown"
+	}
+}
+
+// SetQueueLimit limits the number of submitted tasks that may be waiting to start, and sets what happens
+// to submissions beyond that limit. Tasks waiting for their dependencies count towards the limit, tasks
+// waiting to be retried or for the time they were submitted for do not. A capacity of zero or less removes the limit.
+func (s *Scheduler) SetQueueLimit(capacity int, policy OverflowPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capacity = capacity
+	s.overflow = policy
+	s.wake.Broadcast()
+}
+
+// TrySubmit submits a task like Submit, but never waits for room in the queue:
+// where Submit would block, it returns ErrQueueFull instead.
+func (s *Scheduler) TrySubmit(t *task.Task) error {
+	return s.submit(context.Background(), true, []*task.Task{t}, time.Time{})
+}
+
+// SubmitContext submits a task like Submit. If the queue is full and the scheduler's overflow policy
+// is OverflowBlock, it waits for room until ctx is done, and then returns the context's error.
+// With OverflowCallerRuns, a task run by the caller executes with ctx.
+func (s *Scheduler) SubmitContext(ctx context.Context, t *task.Task) error {
+	return s.submit(ctx, false, []*task.Task{t}, time.Time{})
+}
+
+// submit validates tasks and admits them according to the scheduler's queue limit, holding them until
+// the given time if it is in the future. If try is true, it returns ErrQueueFull rather than waiting for room.
+func (s *Scheduler) submit(ctx context.Context, try bool, tasks []*task.Task, at time.Time) error {
+	var dropped []*task.Task
+	defer func() {
+		for _, t := range dropped {
+			t.CancelWithCause(ErrDropped)
+		}
+	}()
+
+	s.mu.Lock()
+	var stopWatching func()
+	defer func() {
+		if stopWatching != nil {
+			stopWatching()
+		}
+	}()
+
+	var order []*task.Task
+	var dups map[*task.Task]*task.Task
+	for {
+		var err error
+		if s.draining || s.stopped {
+			s.mu.Unlock()
+			return ErrStopped
+		}
+		order, err = s.validate(tasks)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		// Duplicates share the execution of other tasks, so they need no room.
+		dups = s.duplicates(order)
+		fresh := order
+		if len(dups) > 0 {
+			fresh = nil
+			for _, t := range order {
+				if _, duplicate := dups[t]; !duplicate {
+					fresh = append(fresh, t)
+				}
+			}
+		}
+		if at.After(s.clock.Now()) || s.hasRoom(len(fresh)) {
+			break
+		}
+		if len(fresh) > s.capacity {
+			s.mu.Unlock()
+			return ErrQueueFull
+		}
+
+		switch s.overflow {
+		case OverflowBlock:
+			if try || s.stopped {
+				s.mu.Unlock()
+				return ErrQueueFull
+			}
+			if err := ctx.Err(); err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			if stopWatching == nil {
+				stopWatching = s.wakeOnDone(ctx)
+			}
+			s.wake.Wait()
+			continue
+		case OverflowDropOldest, OverflowDropLowest:
+			dropped = s.victims(fresh)
+			if dropped == nil {
+				s.mu.Unlock()
+				return ErrQueueFull
+			}
+			for _, t := range dropped {
+				s.remove(t)
+			}
+		case OverflowCallerRuns:
+			if len(fresh) != 1 || !s.dependenciesDone(fresh[0]) {
+				s.mu.Unlock()
+				return ErrQueueFull
+			}
+			return s.runInCaller(ctx, fresh[0])
+		default:
+			s.mu.Unlock()
+			return ErrQueueFull
+		}
+		break
+	}
+	defer s.mu.Unlock()
+
+	for _, t := range order {
+		if original, duplicate := dups[t]; duplicate {
+			if err := s.attach(t, original); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.accept(t); err != nil {
+			return err
+		}
+		if at.After(s.clock.Now()) {
+			s.delay(t, at)
+		} else if !s.holdForDependencies(t) {
+			s.enqueue(t)
+		}
+	}
+	return nil
+}
+
+// accept records t as submitted. It must be called with s.mu held.
+func (s *Scheduler) accept(t *task.Task) error {
+	if err := t.MarkSubmittedAt(s.clock.Now()); err != nil {
+		return err
+	}
+	s.track(t)
+	s.remember(t)
+	s.expire(t)
+	return nil
+}
+
+// hasRoom returns true if n more tasks can wait to start without exceeding the queue limit.
+// It must be called with s.mu held.
+func (s *Scheduler) hasRoom(n int) bool {
+	return s.capacity <= 0 || s.waiting()+n <= s.capacity
+}
+
+// waiting returns the number of submitted tasks that count towards the queue limit. It must be called with s.mu held.
+func (s *Scheduler) waiting() int {
+	return s.queue.Len() + len(s.blocked) + len(s.parked)
+}
+
+// victims returns the queued tasks to drop so that order can be admitted under the scheduler's
+// overflow policy, or nil if not enough tasks can be dropped. It must be called with s.mu held.
+func (s *Scheduler) victims(order []*task.Task) []*task.Task {
+	need := s.waiting() + len(order) - s.capacity
+	candidates := s.queue.Tasks()
+
+	if s.overflow == OverflowDropLowest {
+		lowest := order[0].Priority()
+		for _, t := range order[1:] {
+			if t.Priority() < lowest {
+				lowest = t.Priority()
+			}
+		}
+		eligible := candidates[:0]
+		for _, t := range candidates {
+			if t.Priority() < lowest {
+				eligible = append(eligible, t)
+			}
+		}
+		candidates = eligible
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Priority() < candidates[j].Priority()
+		})
+	}
+
+	if len(candidates) < need {
+		return nil
+	}
+	return candidates[:need]
+}
+
+// dependenciesDone returns true if all of t's dependencies have completed.
+func (s *Scheduler) dependenciesDone(t *task.Task) bool {
+	for _, dep := range t.Dependencies() {
+		if !dep.State().IsTerminal() {
+			return false
+		}
+	}
+	return true
+}
+
+// runInCaller submits t and executes it in the calling goroutine with ctx, like a worker would, unless a
+// dependency's failure resolves it first. It returns ErrQueueFull if t's resources are not available.
+// It must be called with s.mu held, and releases it.
+func (s *Scheduler) runInCaller(ctx context.Context, t *task.Task) error {
+	if !s.acquire(t) {
+		s.mu.Unlock()
+		return ErrQueueFull
+	}
+	if err := s.accept(t); err != nil {
+		s.mu.Unlock()
+		s.release(t)
+		return err
+	}
+	if s.holdForDependencies(t) {
+		s.mu.Unlock()
+		s.release(t)
+		return nil
+	}
+	// The caller takes the place of a worker, so that the task is counted like any other running task.
+	s.running++
+	s.noteIdle()
+	s.mu.Unlock()
+
+	if s.executor.CrashOnPanic() {
+		ctx = task.WithCrashOnPanic(ctx)
+	}
+	ctx = task.WithClock(ctx, s.clock)
+	_ = t.Execute(ctx)
+	s.release(t)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.noteIdle()
+	s.wake.Broadcast()
+	s.scheduleRetry(t)
+	return nil
+}
+
+// wakeOnDone wakes goroutines waiting on s.wake when ctx is done, until the returned function is called.
+func (s *Scheduler) wakeOnDone(ctx context.Context) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.wake.Broadcast()
+			s.mu.Unlock()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
@@ -0,0 +1,183 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/executor"
+	"github.com/CSXL/go-agent/resource"
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerQueueLimit(t *testing.T) {
+	// newFullScheduler returns a scheduler with one worker, busy until release is closed,
+	// and a queue of capacity 2 that already holds the returned tasks.
+	newFullScheduler := func(t *testing.T, policy scheduler.OverflowPolicy) (*scheduler.Scheduler, chan struct{}, []*task.Task) {
+		sch := newScheduler(t, 1, func(sch *scheduler.Scheduler) { sch.SetQueueLimit(2, policy) })
+		release := make(chan struct{})
+		t.Cleanup(func() {
+			select {
+			case <-release:
+			default:
+				close(release)
+			}
+		})
+
+		started := make(chan struct{})
+		busy := task.NewTask("busy", func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}, task.MediumPriority)
+		assert.NoError(t, sch.Submit(busy))
+		<-started
+
+		queued := []*task.Task{
+			task.NewTask("low", func(ctx context.Context) error { return nil }, task.LowPriority),
+			task.NewTask("high", func(ctx context.Context) error { return nil }, task.HighPriority),
+		}
+		for _, tsk := range queued {
+			assert.NoError(t, sch.Submit(tsk))
+		}
+		return sch, release, queued
+	}
+
+	t.Run("fail fast", func(t *testing.T) {
+		sch, _, _ := newFullScheduler(t, scheduler.OverflowFailFast)
+
+		tsk := task.NewTask("rejected", func(ctx context.Context) error { return nil }, task.HighPriority)
+		assert.ErrorIs(t, sch.Submit(tsk), scheduler.ErrQueueFull)
+		_, err := sch.Task("rejected")
+		assert.ErrorIs(t, err, scheduler.ErrTaskNotFound)
+	})
+
+	t.Run("block", func(t *testing.T) {
+		sch, release, _ := newFullScheduler(t, scheduler.OverflowBlock)
+
+		tsk := task.NewTask("waiting", func(ctx context.Context) error { return nil }, task.LowPriority)
+		assert.ErrorIs(t, sch.TrySubmit(tsk), scheduler.ErrQueueFull)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, sch.SubmitContext(ctx, tsk), context.DeadlineExceeded)
+
+		submitted := make(chan error)
+		go func() {
+			submitted <- sch.SubmitContext(context.Background(), tsk)
+		}()
+		select {
+		case <-submitted:
+			t.Fatal("submission did not wait for room in the queue")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		assert.NoError(t, <-submitted)
+		assert.NoError(t, tsk.Wait(context.Background()))
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		sch, release, queued := newFullScheduler(t, scheduler.OverflowDropOldest)
+
+		tsk := task.NewTask("newest", func(ctx context.Context) error { return nil }, task.LowPriority)
+		assert.NoError(t, sch.Submit(tsk))
+		assert.Equal(t, task.Canceled, queued[0].State())
+		assert.ErrorIs(t, queued[0].Err(), scheduler.ErrDropped)
+
+		close(release)
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.NoError(t, queued[1].Wait(context.Background()))
+	})
+
+	t.Run("drop lowest", func(t *testing.T) {
+		sch, release, queued := newFullScheduler(t, scheduler.OverflowDropLowest)
+
+		low := task.NewTask("lower", func(ctx context.Context) error { return nil }, task.LowPriority)
+		assert.ErrorIs(t, sch.Submit(low), scheduler.ErrQueueFull)
+
+		tsk := task.NewTask("medium", func(ctx context.Context) error { return nil }, task.MediumPriority)
+		assert.NoError(t, sch.Submit(tsk))
+		assert.Equal(t, task.Canceled, queued[0].State())
+		assert.ErrorIs(t, queued[0].Err(), scheduler.ErrDropped)
+		assert.Equal(t, task.Ready, queued[1].State())
+
+		close(release)
+		assert.NoError(t, tsk.Wait(context.Background()))
+	})
+
+	t.Run("caller runs", func(t *testing.T) {
+		sch, _, queued := newFullScheduler(t, scheduler.OverflowCallerRuns)
+
+		ran := false
+		tsk := task.NewTask("caller", func(ctx context.Context) error {
+			ran = true
+			return nil
+		}, task.LowPriority)
+		assert.NoError(t, sch.Submit(tsk))
+		assert.True(t, ran)
+		assert.Equal(t, task.Succeeded, tsk.State())
+
+		dependent := task.NewTask("dependent", func(ctx context.Context) error { return nil }, task.LowPriority)
+		dependent.AddDependency(queued[0])
+		assert.ErrorIs(t, sch.Submit(dependent), scheduler.ErrQueueFull)
+	})
+
+	t.Run("caller runs as a running task", func(t *testing.T) {
+		sch := newScheduler(t, 1, func(sch *scheduler.Scheduler) { sch.SetQueueLimit(1, scheduler.OverflowCallerRuns) })
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		busy := task.NewTask("busy", func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}, task.MediumPriority)
+		assert.NoError(t, sch.Submit(busy))
+		<-started
+		assert.NoError(t, sch.Submit(task.NewTask("queued", func(ctx context.Context) error { return nil }, task.LowPriority)))
+
+		callerRelease := make(chan struct{})
+		caller := task.NewTask("caller", func(ctx context.Context) error {
+			<-callerRelease
+			return nil
+		}, task.LowPriority)
+		go func() { _ = sch.Submit(caller) }()
+		assert.Eventually(t, func() bool { return caller.State() == task.Running }, time.Second, time.Millisecond)
+		close(release)
+
+		// Shutdown waits for the task running in the caller like for any other running task.
+		shutDown := make(chan struct{})
+		go func() {
+			_, _ = sch.Shutdown(context.Background())
+			close(shutDown)
+		}()
+		assert.Never(t, func() bool {
+			select {
+			case <-shutDown:
+				return true
+			default:
+				return false
+			}
+		}, 50*time.Millisecond, time.Millisecond)
+
+		close(callerRelease)
+		<-shutDown
+		assert.Equal(t, task.Succeeded, caller.State())
+	})
+
+	t.Run("graph larger than capacity", func(t *testing.T) {
+		sch := scheduler.NewScheduler(executor.NewExecutor(1), resource.NewManager())
+		sch.SetQueueLimit(1, scheduler.OverflowBlock)
+
+		a := task.NewTask("a", func(ctx context.Context) error { return nil }, task.LowPriority)
+		b := task.NewTask("b", func(ctx context.Context) error { return nil }, task.LowPriority)
+		err := sch.SubmitGraph(a, b)
+		assert.True(t, errors.Is(err, scheduler.ErrQueueFull))
+		assert.Equal(t, task.Pending, a.State())
+	})
+}
@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/CSXL/go-agent/clock"
+)
+
+// Autoscale configures how a scheduler adjusts the number of its executor's workers to its load.
+type Autoscale struct {
+	// Min is the fewest workers to scale down to. Values below 1 are treated as 1.
+	Min int
+
+	// Max is the most workers to scale up to. A Max of zero or less disables autoscaling.
+	// Values below Min are treated as Min.
+	Max int
+
+	// QueueDepth is the number of ready tasks that must be queued while every worker is busy to scale up.
+	// The pool grows by the number of queued tasks, up to Max. Values below 1 are treated as 1.
+	QueueDepth int
+
+	// IdleTimeout is how long a worker must have been idle to scale down by one worker.
+	// Values of zero or less are treated as one minute.
+	IdleTimeout time.Duration
+
+	// UpCooldown is how long to wait after scaling before scaling up.
+	UpCooldown time.Duration
+
+	// DownCooldown is how long to wait after scaling before scaling down.
+	DownCooldown time.Duration
+
+	// Interval is how often the load is evaluated. Values of zero or less are treated as one second.
+	Interval time.Duration
+}
+
+// Reasons given by Scaled events for scaling decisions.
+const (
+	// ScaledForBounds is the reason for scaling a pool that is outside the autoscaling bounds into them.
+	ScaledForBounds = "bounds"
+
+	// ScaledForQueueDepth is the reason for scaling up when tasks are queued while every worker is busy.
+	ScaledForQueueDepth = "queue depth"
+
+	// ScaledForIdleWorkers is the reason for scaling down when a worker has been idle for the idle timeout.
+	ScaledForIdleWorkers = "idle workers"
+)
+
+// Resize changes the number of workers of the scheduler's executor to n, as executor.Executor.Resize does.
+// Tasks are dispatched to new workers immediately, and removed workers exit once they have finished their
+// current task. An autoscaler, if any, may resize the executor again.
+func (s *Scheduler) Resize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.executor.Resize(n)
+	s.noteIdle()
+	s.wake.Broadcast()
+}
+
+// SetAutoscale enables autoscaling with the given configuration, replacing any previous one. Every Interval,
+// the executor is scaled up if tasks are queued while every worker is busy, or down by one worker if a worker
+// has been idle for IdleTimeout, within Min and Max workers. Each decision is emitted as a Scaled event.
+// A configuration with a Max of zero or less disables autoscaling, which is the default.
+func (s *Scheduler) SetAutoscale(cfg Autoscale) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.autoscaler != nil {
+		s.autoscaler.timer.Stop()
+		s.autoscaler = nil
+	}
+	if cfg.Max < 1 || s.stopped {
+		return
+	}
+
+	if cfg.Min < 1 {
+		cfg.Min = 1
+	}
+	if cfg.Max < cfg.Min {
+		cfg.Max = cfg.Min
+	}
+	if cfg.QueueDepth < 1 {
+		cfg.QueueDepth = 1
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = time.Minute
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	a := &autoscaler{cfg: cfg}
+	s.autoscaler = a
+	s.noteIdle()
+	a.timer = s.clock.AfterFunc(cfg.Interval, func() { s.autoscale(a) })
+}
+
+// autoscaler is the state of an enabled autoscaling configuration.
+type autoscaler struct {
+	cfg        Autoscale
+	timer      clock.Timer
+	idleSince  time.Time
+	lastScaled time.Time
+}
+
+// decide returns the number of workers to scale to at now, and the reason, given the current number of
+// workers, queued tasks and running tasks. It returns the current number of workers if none is needed.
+func (a *autoscaler) decide(now time.Time, workers, queued, running int) (int, string) {
+	cfg := a.cfg
+	if workers < cfg.Min {
+		return cfg.Min, ScaledForBounds
+	}
+	if workers > cfg.Max {
+		return cfg.Max, ScaledForBounds
+	}
+
+	cooled := func(cooldown time.Duration) bool {
+		return a.lastScaled.IsZero() || !now.Before(a.lastScaled.Add(cooldown))
+	}
+	if workers < cfg.Max && running >= workers && queued >= cfg.QueueDepth && cooled(cfg.UpCooldown) {
+		target := workers + queued
+		if target > cfg.Max {
+			target = cfg.Max
+		}
+		return target, ScaledForQueueDepth
+	}
+	if workers > cfg.Min && !a.idleSince.IsZero() && !now.Before(a.idleSince.Add(cfg.IdleTimeout)) &&
+		cooled(cfg.DownCooldown) {
+		return workers - 1, ScaledForIdleWorkers
+	}
+	return workers, ""
+}
+
+// autoscale evaluates the load, scales the executor if needed, and sets a timer to evaluate it again.
+func (s *Scheduler) autoscale(a *autoscaler) {
+	s.mu.Lock()
+	if s.autoscaler != a || s.stopped {
+		s.mu.Unlock()
+		return
+	}
+
+	now := s.clock.Now()
+	workers := s.executor.WorkerCount()
+	target, reason := a.decide(now, workers, s.queue.Len(), s.running)
+	if target != workers {
+		s.executor.Resize(target)
+		a.lastScaled = now
+		// Workers that remain idle after scaling down are idle from now on.
+		a.idleSince = time.Time{}
+		s.noteIdle()
+		s.wake.Broadcast()
+	}
+	a.timer = s.clock.AfterFunc(a.cfg.Interval, func() { s.autoscale(a) })
+	subscribers := s.subscribers
+	s.mu.Unlock()
+
+	if target != workers {
+		emit(subscribers, Event{
+			Type:       Scaled,
+			OldWorkers: workers,
+			NewWorkers: target,
+			Reason:     reason,
+			At:         time.Now(),
+		})
+	}
+}
+
+// noteIdle records when a worker became idle for the autoscaler, if any. It must be called with s.mu held
+// whenever the number of running tasks or workers changes.
+func (s *Scheduler) noteIdle() {
+	a := s.autoscaler
+	if a == nil {
+		return
+	}
+	if s.running >= s.executor.WorkerCount() {
+		a.idleSince = time.Time{}
+	} else if a.idleSince.IsZero() {
+		a.idleSince = s.clock.Now()
+	}
+}
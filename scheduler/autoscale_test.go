@@ -0,0 +1,160 @@
+package scheduler_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerResize(t *testing.T) {
+	sch := newScheduler(t, 1)
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	defer close(release)
+	for _, id := range []string{"first", "second"} {
+		id := id
+		assert.NoError(t, sch.Submit(task.NewTask(id, func(ctx context.Context) error {
+			started <- id
+			<-release
+			return nil
+		}, task.LowPriority)))
+	}
+	assert.Equal(t, "first", <-started)
+
+	// The queued task is dispatched to the new worker without waiting for the first to complete.
+	sch.Resize(2)
+	assert.Equal(t, "second", <-started)
+}
+
+func TestSchedulerAutoscale(t *testing.T) {
+	newAutoscaled := func(t *testing.T, workers int) (*scheduler.Scheduler, *clock.Fake, func() []scheduler.Event) {
+		var mu sync.Mutex
+		var events []scheduler.Event
+		sch, c := newFakeScheduler(t, workers, func(sch *scheduler.Scheduler) {
+			sch.Subscribe(func(e scheduler.Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, e)
+			})
+		})
+
+		scaled := func() []scheduler.Event {
+			mu.Lock()
+			defer mu.Unlock()
+			defer func() { events = nil }()
+			return events
+		}
+		return sch, c, scaled
+	}
+
+	expectScaled := func(t *testing.T, events []scheduler.Event, from, to int, reason string) {
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, scheduler.Scaled, events[0].Type)
+			assert.Equal(t, from, events[0].OldWorkers)
+			assert.Equal(t, to, events[0].NewWorkers)
+			assert.Equal(t, reason, events[0].Reason)
+		}
+	}
+
+	t.Run("scales up by queue depth", func(t *testing.T) {
+		sch, c, scaled := newAutoscaled(t, 1)
+		sch.SetAutoscale(scheduler.Autoscale{Min: 1, Max: 3, UpCooldown: time.Minute})
+
+		started := make(chan string, 5)
+		release := make(chan struct{})
+		defer close(release)
+		for i := 1; i <= 5; i++ {
+			id := fmt.Sprintf("task-%d", i)
+			assert.NoError(t, sch.Submit(task.NewTask(id, func(ctx context.Context) error {
+				started <- id
+				<-release
+				return nil
+			}, task.LowPriority)))
+		}
+		assert.Equal(t, "task-1", <-started)
+
+		// The pool grows by the queued tasks, up to the maximum.
+		c.Advance(time.Second)
+		expectScaled(t, scaled(), 1, 3, scheduler.ScaledForQueueDepth)
+		assert.ElementsMatch(t, []string{"task-2", "task-3"}, []string{<-started, <-started})
+
+		c.Advance(time.Minute)
+		assert.Empty(t, scaled())
+	})
+
+	t.Run("scales down idle workers", func(t *testing.T) {
+		sch, c, scaled := newAutoscaled(t, 3)
+		sch.SetAutoscale(scheduler.Autoscale{
+			Min:          1,
+			Max:          3,
+			IdleTimeout:  time.Minute,
+			DownCooldown: 2 * time.Minute,
+			Interval:     time.Minute,
+		})
+
+		c.Advance(time.Minute)
+		expectScaled(t, scaled(), 3, 2, scheduler.ScaledForIdleWorkers)
+
+		// The cooldown delays the next decision.
+		c.Advance(time.Minute)
+		assert.Empty(t, scaled())
+		c.Advance(time.Minute)
+		expectScaled(t, scaled(), 2, 1, scheduler.ScaledForIdleWorkers)
+
+		c.Advance(10 * time.Minute)
+		assert.Empty(t, scaled())
+	})
+
+	t.Run("busy workers are not idle", func(t *testing.T) {
+		sch, c, scaled := newAutoscaled(t, 2)
+		sch.SetAutoscale(scheduler.Autoscale{Min: 1, Max: 2, IdleTimeout: time.Minute, Interval: time.Minute})
+
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		for i := 1; i <= 2; i++ {
+			assert.NoError(t, sch.Submit(task.NewTask(fmt.Sprintf("task-%d", i), func(ctx context.Context) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			}, task.LowPriority)))
+		}
+		<-started
+		<-started
+
+		c.Advance(time.Minute)
+		assert.Empty(t, scaled())
+
+		// Workers are idle from when their tasks complete.
+		close(release)
+		assert.Eventually(t, func() bool {
+			c.Advance(time.Minute)
+			return len(scaled()) == 1
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("bounds", func(t *testing.T) {
+		sch, c, scaled := newAutoscaled(t, 5)
+		sch.SetAutoscale(scheduler.Autoscale{Min: 1, Max: 2})
+
+		c.Advance(time.Second)
+		expectScaled(t, scaled(), 5, 2, scheduler.ScaledForBounds)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		sch, c, scaled := newAutoscaled(t, 5)
+		sch.SetAutoscale(scheduler.Autoscale{Min: 1, Max: 2})
+		sch.SetAutoscale(scheduler.Autoscale{})
+
+		c.Advance(time.Hour)
+		assert.Empty(t, scaled())
+	})
+}
@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/task"
+)
+
+// SetClock sets the clock used to time delayed tasks, retries, queue expiry and aging. It must be called
+// before the scheduler is started.
+func (s *Scheduler) SetClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = c
+	s.executor.SetClock(c)
+	s.queue.SetClock(c)
+}
+
+// SubmitAt submits a task like Submit, but holds it until the given time before it is queued for execution
+// or waits for its dependencies. A task whose time has already passed is submitted immediately. The task can
+// be canceled with Cancel until it runs. Tasks waiting for their time do not count towards the queue limit.
+func (s *Scheduler) SubmitAt(t *task.Task, at time.Time) error {
+	return s.submit(context.Background(), false, []*task.Task{t}, at)
+}
+
+// SubmitAfter submits a task like SubmitAt, to be released once d has elapsed.
+func (s *Scheduler) SubmitAfter(t *task.Task, d time.Duration) error {
+	s.mu.Lock()
+	at := s.clock.Now().Add(d)
+	s.mu.Unlock()
+	return s.SubmitAt(t, at)
+}
+
+// delay holds t until the given time, and then releases it. It must be called with s.mu held.
+func (s *Scheduler) delay(t *task.Task, at time.Time) {
+	if !at.After(s.clock.Now()) {
+		if !s.holdForDependencies(t) {
+			s.enqueue(t)
+		}
+		return
+	}
+	if d, pending := s.delayed[t]; pending {
+		d.due = at
+		heap.Fix(&s.timers, d.index)
+	} else {
+		d := &delayedTask{task: t, due: at}
+		s.delayed[t] = d
+		heap.Push(&s.timers, d)
+	}
+	s.arm()
+}
+
+// undelay removes t from the delayed tasks, and returns false if it was not delayed. It must be called with s.mu held.
+func (s *Scheduler) undelay(t *task.Task) bool {
+	d, pending := s.delayed[t]
+	if !pending {
+		return false
+	}
+	heap.Remove(&s.timers, d.index)
+	delete(s.delayed, t)
+	s.arm()
+	return true
+}
+
+// arm sets the scheduler's timer to fire when the earliest delayed task is due. It must be called with s.mu held.
+func (s *Scheduler) arm() {
+	if len(s.timers) == 0 || s.stopped {
+		if s.timer != nil {
+			s.timer.Stop()
+			s.timer = nil
+		}
+		return
+	}
+	due := s.timers[0].due
+	if s.timer != nil {
+		if s.armedAt.Equal(due) {
+			return
+		}
+		s.timer.Stop()
+	}
+	s.armedAt = due
+	s.timer = s.clock.AfterFunc(due.Sub(s.clock.Now()), s.fire)
+}
+
+// fire releases every delayed task that is due, and rearms the timer for the rest.
+func (s *Scheduler) fire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timer = nil
+	now := s.clock.Now()
+	for len(s.timers) > 0 && !s.timers[0].due.After(now) {
+		t := heap.Pop(&s.timers).(*delayedTask).task
+		delete(s.delayed, t)
+		if !s.holdForDependencies(t) {
+			s.enqueue(t)
+		}
+	}
+	// Tasks resolved by a failed dependency are no longer held anywhere.
+	s.wake.Broadcast()
+	s.arm()
+}
+
+// delayedTask is a task waiting for the time it is due.
+type delayedTask struct {
+	task  *task.Task
+	due   time.Time
+	index int
+}
+
+// delayHeap implements heap.Interface for delayed tasks, earliest first.
+type delayHeap []*delayedTask
+
+func (h delayHeap) Len() int {
+	return len(h)
+}
+
+func (h delayHeap) Less(i, j int) bool {
+	return h[i].due.Before(h[j].due)
+}
+
+func (h delayHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *delayHeap) Push(x interface{}) {
+	d := x.(*delayedTask)
+	d.index = len(*h)
+	*h = append(*h, d)
+}
+
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	d := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return d
+}
@@ -0,0 +1,112 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerDelay(t *testing.T) {
+	newTask := func(id string, started chan<- string) *task.Task {
+		return task.NewTask(id, func(ctx context.Context) error {
+			started <- id
+			return nil
+		}, task.LowPriority)
+	}
+
+	t.Run("submit at", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+
+		started := make(chan string, 2)
+		assert.NoError(t, sch.SubmitAt(newTask("later", started), epoch.Add(time.Hour)))
+		assert.NoError(t, sch.SubmitAfter(newTask("sooner", started), time.Minute))
+
+		c.Advance(59 * time.Second)
+		select {
+		case id := <-started:
+			t.Fatalf("%s started early", id)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		c.Advance(time.Second)
+		assert.Equal(t, "sooner", <-started)
+		c.Set(epoch.Add(time.Hour))
+		assert.Equal(t, "later", <-started)
+	})
+
+	t.Run("past time", func(t *testing.T) {
+		sch, _ := newFakeScheduler(t, 2)
+
+		started := make(chan string, 1)
+		assert.NoError(t, sch.SubmitAt(newTask("past", started), epoch.Add(-time.Hour)))
+		assert.Equal(t, "past", <-started)
+	})
+
+	t.Run("cancel before firing", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+
+		started := make(chan string, 1)
+		tsk := newTask("delayed", started)
+		assert.NoError(t, sch.SubmitAfter(tsk, time.Minute))
+		assert.NoError(t, sch.Cancel("delayed", scheduler.ErrCanceled))
+
+		c.Advance(time.Hour)
+		assert.Equal(t, task.Canceled, tsk.State())
+		assert.Equal(t, 0, tsk.Attempts())
+	})
+
+	t.Run("dependencies", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+
+		started := make(chan string, 2)
+		dep := newTask("dep", started)
+		dependent := newTask("dependent", started)
+		dependent.AddDependency(dep)
+		assert.NoError(t, sch.SubmitAfter(dep, time.Minute))
+		assert.NoError(t, sch.Submit(dependent))
+
+		c.Advance(time.Minute)
+		assert.Equal(t, "dep", <-started)
+		assert.Equal(t, "dependent", <-started)
+	})
+
+	t.Run("retry backoff", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+
+		attempted := make(chan struct{}, 2)
+		tsk := task.NewTask("retry", func(ctx context.Context) error {
+			attempted <- struct{}{}
+			if task.Attempt(ctx) == 1 {
+				return errors.New("try again")
+			}
+			return nil
+		}, task.LowPriority)
+		tsk.SetRetryPolicy(task.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute})
+		assert.NoError(t, sch.Submit(tsk))
+		<-attempted
+
+		select {
+		case <-attempted:
+			t.Fatal("retried before the backoff elapsed")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		// The retry is scheduled once the worker reports the failed attempt, so keep advancing until it runs.
+		for done := false; !done; {
+			c.Advance(time.Minute)
+			select {
+			case <-tsk.Done():
+				done = true
+			case <-time.After(time.Millisecond):
+			}
+		}
+		assert.Equal(t, task.Succeeded, tsk.State())
+		assert.Equal(t, 2, tsk.Attempts())
+	})
+}
@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/CSXL/go-agent/task"
+)
+
+// EventType identifies the kind of an Event.
+type EventType int
+
+const (
+	// PriorityChanged is emitted when the priority of a submitted task is updated.
+	PriorityChanged EventType = iota
+
+	// Preempted is emitted when a running task is preempted to free its worker for a higher-priority task.
+	Preempted
+
+	// Scaled is emitted when the autoscaler changes the number of the executor's workers. It concerns no task.
+	Scaled
+)
+
+// String returns the name of the event type.
+func (e EventType) String() string {
+	switch e {
+	case PriorityChanged:
+		return "priority changed"
+	case Preempted:
+		return "preempted"
+	case Scaled:
+		return "scaled"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a scheduling decision made for a task.
+type Event struct {
+	// Type is the kind of event.
+	Type EventType
+
+	// TaskID is the identifier of the task the event concerns.
+	TaskID string
+
+	// OldPriority is the task's priority before a PriorityChanged event.
+	OldPriority task.Priority
+
+	// NewPriority is the task's priority after a PriorityChanged event.
+	NewPriority task.Priority
+
+	// OldWorkers is the number of workers before a Scaled event.
+	OldWorkers int
+
+	// NewWorkers is the number of workers after a Scaled event.
+	NewWorkers int
+
+	// Reason describes why a Scaled event's decision was made, e.g. ScaledForQueueDepth.
+	Reason string
+
+	// At is the time the event occurred.
+	At time.Time
+}
+
+// subscriber is a registered subscriber to a scheduler's events.
+type subscriber struct {
+	id int
+	fn func(Event)
+}
+
+// Subscribe registers fn to be called with each event emitted by the scheduler, and returns a function
+// that removes the subscription. fn is called synchronously by the goroutine that caused the event,
+// so it should return quickly.
+func (s *Scheduler) Subscribe(fn func(Event)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextSubscriber
+	s.nextSubscriber++
+	s.subscribers = append(s.subscribers, subscriber{id: id, fn: fn})
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, sub := range s.subscribers {
+			if sub.id == id {
+				s.subscribers = append(s.subscribers[:i:i], s.subscribers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// emit calls each of subscribers with e.
+func emit(subscribers []subscriber, e Event) {
+	for _, sub := range subscribers {
+		sub.fn(e)
+	}
+}
@@ -0,0 +1,37 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/executor"
+	"github.com/CSXL/go-agent/resource"
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerSubscribe(t *testing.T) {
+	sch := scheduler.NewScheduler(executor.NewExecutor(1), resource.NewManager())
+
+	tsk := task.NewTask("task", func(ctx context.Context) error { return nil }, task.LowPriority)
+	assert.NoError(t, sch.Submit(tsk))
+
+	var events []scheduler.Event
+	unsubscribe := sch.Subscribe(func(e scheduler.Event) {
+		events = append(events, e)
+	})
+	assert.NoError(t, sch.UpdatePriority("task", task.HighPriority))
+
+	unsubscribe()
+	assert.NoError(t, sch.UpdatePriority("task", task.MediumPriority))
+
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, scheduler.PriorityChanged, events[0].Type)
+		assert.Equal(t, "task", events[0].TaskID)
+		assert.Equal(t, task.LowPriority, events[0].OldPriority)
+		assert.Equal(t, task.HighPriority, events[0].NewPriority)
+		assert.False(t, events[0].At.IsZero())
+	}
+}
@@ -0,0 +1,32 @@
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/CSXL/go-agent/task"
+)
+
+// expire sets a timer to resolve t as timed out if it is still waiting to start at its queue expiry, if it
+// expires before start, so that callers waiting for it are not held until it is dispatched. It must be
+// called with s.mu held.
+func (s *Scheduler) expire(t *task.Task) {
+	expiry, ok := t.QueueExpiry()
+	if !ok {
+		return
+	}
+	timer := s.clock.AfterFunc(expiry.Sub(s.clock.Now()), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if state := t.State(); state != task.Pending && state != task.Ready {
+			return
+		}
+		s.remove(t)
+		_ = t.Abandon(task.TimedOut, fmt.Errorf("%w: expired before start", task.ErrTimeout))
+	})
+
+	t.Watch(func(tr task.Transition) {
+		if tr.To.IsTerminal() {
+			timer.Stop()
+		}
+	})
+}
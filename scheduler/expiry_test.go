@@ -0,0 +1,82 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerExpireBeforeStart(t *testing.T) {
+	newQueued := func(t *testing.T, sch *scheduler.Scheduler) (*task.Task, func()) {
+		release := make(chan struct{})
+		started := make(chan struct{})
+		blocker := task.NewTask("blocker", func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}, task.HighPriority)
+		assert.NoError(t, sch.Submit(blocker))
+		<-started
+
+		tsk := task.NewTask("queued", func(ctx context.Context) error { return nil }, task.LowPriority)
+		tsk.SetTimeout(50 * time.Millisecond)
+		tsk.SetExpireBeforeStart(true)
+		assert.NoError(t, sch.Submit(tsk))
+		return tsk, func() { close(release) }
+	}
+
+	t.Run("while queued", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		tsk, release := newQueued(t, sch)
+		defer release()
+
+		// The task expires while the only worker is still busy.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.NoError(t, tsk.Wait(ctx))
+		assert.Equal(t, task.TimedOut, tsk.State())
+		assert.ErrorIs(t, tsk.Err(), task.ErrTimeout)
+		assert.Equal(t, 0, tsk.Attempts())
+	})
+
+	t.Run("clock", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 1)
+
+		tsk, release := newQueued(t, sch)
+		defer release()
+		assert.Equal(t, epoch, tsk.SubmittedAt())
+
+		// The expiry is measured with the scheduler's clock, not the time that has really passed.
+		time.Sleep(100 * time.Millisecond)
+		c.Advance(49 * time.Millisecond)
+		assert.Equal(t, task.Ready, tsk.State())
+
+		c.Advance(time.Millisecond)
+		assert.Equal(t, task.TimedOut, tsk.State())
+	})
+
+	t.Run("started in time by the clock", func(t *testing.T) {
+		sch, _ := newFakeScheduler(t, 1)
+
+		tsk, release := newQueued(t, sch)
+		time.Sleep(100 * time.Millisecond)
+		release()
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, tsk.State())
+	})
+
+	t.Run("started in time", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		tsk, release := newQueued(t, sch)
+		release()
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, tsk.State())
+	})
+}
@@ -0,0 +1,480 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/task"
+)
+
+// GroupStats describes the queued and dispatched tasks of one group.
+type GroupStats struct {
+	// Weight is the group's share of workers relative to other groups with tasks of the same priority.
+	Weight int
+
+	// Queued is the number of the group's tasks waiting to be dispatched.
+	Queued int
+
+	// Dispatched is the number of the group's tasks handed to the executor.
+	Dispatched uint64
+
+	// Share is the fraction of all dispatched tasks that belonged to the group.
+	Share float64
+
+	// RateLimit is the group's rate limit, or the zero RateLimit if it has none.
+	RateLimit RateLimit
+
+	// Throttled is the total time the group has had queued tasks that were held back by its rate limit.
+	Throttled time.Duration
+}
+
+// SetGroupWeight sets the weight of a group of tasks. When several groups have queued tasks of the same
+// priority, each is dispatched tasks in proportion to its weight. Weights below 1 are treated as 1,
+// which is also the weight of groups that have not been given one.
+func (s *Scheduler) SetGroupWeight(group string, weight int) {
+	s.queue.SetWeight(group, weight)
+}
+
+// GroupStats returns statistics for each group that has queued tasks, a weight or a rate limit, or has been
+// throttled, keyed by group. The statistics of other groups are discarded once their last queued task is dequeued.
+func (s *Scheduler) GroupStats() map[string]GroupStats {
+	return s.queue.Stats(s.clock.Now())
+}
+
+// fairQueue is a queue of ready tasks that shares dispatches between groups by weighted fair share.
+// Each group's tasks are ordered by its own Policy. The next task always comes from the group whose head is
+// the most urgent, and groups tied at that urgency are served by deficit round robin: each round, every
+// tied group earns credit equal to its weight, and each dispatch spends one.
+type fairQueue struct {
+	mu         sync.Mutex
+	newPolicy  func() Policy
+	groups     map[string]*group
+	order      []string
+	next       int
+	entries    map[*task.Task]entry
+	seq        uint64
+	aging      time.Duration
+	clock      clock.Clock
+	dispatched uint64
+}
+
+// group is the queue and accounting of one group of tasks.
+type group struct {
+	queue          Policy
+	weight         int
+	deficit        int
+	dispatched     uint64
+	limiter        *limiter
+	throttled      time.Duration
+	throttledSince time.Time
+}
+
+// allow returns true if the group's rate limit lets a task be dispatched at now.
+func (g *group) allow(now time.Time) bool {
+	return g.limiter == nil || g.limiter.allow(now)
+}
+
+// throttle records that the group's queued tasks are held back by its rate limit from now on.
+func (g *group) throttle(now time.Time) {
+	if g.throttledSince.IsZero() {
+		g.throttledSince = now
+	}
+}
+
+// unthrottle records that the group's queued tasks are no longer held back by its rate limit at now.
+func (g *group) unthrottle(now time.Time) {
+	g.throttled = g.throttledAt(now)
+	g.throttledSince = time.Time{}
+}
+
+// throttledAt returns the total time the group has been throttled by now. A period of throttling
+// ends when a token became available, even if no task has been dispatched since.
+func (g *group) throttledAt(now time.Time) time.Duration {
+	if g.throttledSince.IsZero() {
+		return g.throttled
+	}
+	end := now
+	if g.limiter != nil {
+		if ready := g.limiter.readyAt(); ready.Before(end) {
+			end = ready
+		}
+	}
+	if end.Before(g.throttledSince) {
+		return g.throttled
+	}
+	return g.throttled + end.Sub(g.throttledSince)
+}
+
+// entry records the group a queued task was pushed to, and the order it was pushed in.
+type entry struct {
+	group *group
+	seq   uint64
+}
+
+// newFairQueue creates an empty fairQueue.
+func newFairQueue() *fairQueue {
+	return &fairQueue{
+		newPolicy: NewPriorityPolicy,
+		clock:     clock.Real(),
+		groups:    make(map[string]*group),
+		entries:   make(map[*task.Task]entry),
+	}
+}
+
+// group returns the group with the given key, creating it if necessary. It must be called with q.mu held.
+func (q *fairQueue) group(key string) *group {
+	g, exists := q.groups[key]
+	if !exists {
+		g = &group{queue: q.policy(), weight: 1}
+		q.groups[key] = g
+		q.order = append(q.order, key)
+	}
+	return g
+}
+
+// prune removes the group with the given key if it has no queued tasks, the default weight, no rate limit and
+// has never been throttled, so that groups are not kept for every key ever used. Idle groups do not keep credit
+// from earlier rounds, so its deficit is not lost. It must be called with q.mu held.
+func (q *fairQueue) prune(key string) {
+	g, exists := q.groups[key]
+	if !exists || g.queue.Len() > 0 || g.weight != 1 || g.limiter != nil {
+		return
+	}
+	if g.throttled > 0 || !g.throttledSince.IsZero() {
+		return
+	}
+	delete(q.groups, key)
+	for i, k := range q.order {
+		if k != key {
+			continue
+		}
+		q.order = append(q.order[:i], q.order[i+1:]...)
+		if i < q.next {
+			q.next--
+		}
+		break
+	}
+	if q.next >= len(q.order) {
+		q.next = 0
+	}
+}
+
+// policy creates a Policy for a group, with the queue's clock and aging interval if it supports aging.
+// It must be called with q.mu held.
+func (q *fairQueue) policy() Policy {
+	p := q.newPolicy()
+	if aging, ok := p.(interface{ SetClock(clock.Clock) }); ok {
+		aging.SetClock(q.clock)
+	}
+	if aging, ok := p.(interface{ SetAging(time.Duration) }); ok {
+		aging.SetAging(q.aging)
+	}
+	return p
+}
+
+// SetPolicy sets the factory for the policies of each group, and moves the queued tasks to new policies.
+func (q *fairQueue) SetPolicy(newPolicy func() Policy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.newPolicy = newPolicy
+	for _, g := range q.groups {
+		old := g.queue
+		g.queue = q.policy()
+		for _, t := range q.tasks() {
+			if old.Remove(t) {
+				g.queue.Enqueue(t)
+			}
+		}
+	}
+}
+
+// SetWeight sets the weight of the group with the given key.
+func (q *fairQueue) SetWeight(key string, weight int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if weight < 1 {
+		weight = 1
+	}
+	q.group(key).weight = weight
+	q.prune(key)
+}
+
+// SetAging sets the aging interval of every group's policy that supports aging.
+func (q *fairQueue) SetAging(interval time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.aging = interval
+	for _, g := range q.groups {
+		if aging, ok := g.queue.(interface{ SetAging(time.Duration) }); ok {
+			aging.SetAging(interval)
+		}
+	}
+}
+
+// SetClock sets the clock of every group's policy that supports aging. It must be called before any tasks are pushed.
+func (q *fairQueue) SetClock(c clock.Clock) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.clock = c
+	for _, g := range q.groups {
+		if aging, ok := g.queue.(interface{ SetClock(clock.Clock) }); ok {
+			aging.SetClock(c)
+		}
+	}
+}
+
+// Len returns the number of queued tasks.
+func (q *fairQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Push adds a task to the queue of its group. Pushing a task that is already queued has no effect.
+func (q *fairQueue) Push(t *task.Task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, queued := q.entries[t]; queued {
+		return
+	}
+	g := q.group(t.Group())
+	q.seq++
+	q.entries[t] = entry{group: g, seq: q.seq}
+	g.queue.Enqueue(t)
+}
+
+// Pop removes and returns the next task to dispatch at now, or nil if the queue is empty or the
+// groups of all queued tasks are held back by their rate limits.
+func (q *fairQueue) Pop(now time.Time) *task.Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.entries) == 0 {
+		return nil
+	}
+
+	// Find the groups whose heads share the highest urgency, in round-robin order.
+	var tied []int
+	var top int64
+	for i := range q.order {
+		idx := (q.next + i) % len(q.order)
+		g := q.groups[q.order[idx]]
+		head := g.queue.Peek()
+		if head == nil {
+			// Idle groups do not keep credit from earlier rounds.
+			g.deficit = 0
+			g.unthrottle(now)
+			continue
+		}
+		if !g.allow(now) {
+			g.throttle(now)
+			continue
+		}
+		g.unthrottle(now)
+		urgency := g.queue.Urgency(head)
+		switch {
+		case len(tied) == 0 || urgency > top:
+			tied = append(tied[:0], idx)
+			top = urgency
+		case urgency == top:
+			tied = append(tied, idx)
+		}
+	}
+	if len(tied) == 0 {
+		return nil
+	}
+
+	for {
+		for _, idx := range tied {
+			g := q.groups[q.order[idx]]
+			if g.deficit < 1 {
+				continue
+			}
+			g.deficit--
+			q.next = idx
+			if g.deficit < 1 {
+				q.next = (idx + 1) % len(q.order)
+			}
+
+			t := g.queue.Dequeue()
+			delete(q.entries, t)
+			q.prune(q.order[idx])
+			return t
+		}
+		for _, idx := range tied {
+			g := q.groups[q.order[idx]]
+			g.deficit += g.weight
+		}
+	}
+}
+
+// Peek returns the next task of the group whose next task is the most urgent, without removing it,
+// or nil if there is none. Groups held back by their rate limits at now are ignored.
+func (q *fairQueue) Peek(now time.Time) *task.Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var next *task.Task
+	var top int64
+	for i := range q.order {
+		g := q.groups[q.order[(q.next+i)%len(q.order)]]
+		head := g.queue.Peek()
+		if head == nil || !g.allow(now) {
+			continue
+		}
+		if urgency := g.queue.Urgency(head); next == nil || urgency > top {
+			next, top = head, urgency
+		}
+	}
+	return next
+}
+
+// Dispatched records that a task of the given group has been handed to the executor at now,
+// spending a token of its rate limit.
+func (q *fairQueue) Dispatched(key string, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dispatched++
+	g, exists := q.groups[key]
+	if !exists {
+		// The group was pruned when its last task was dequeued.
+		return
+	}
+	g.dispatched++
+	if g.limiter != nil {
+		g.limiter.take(now)
+	}
+}
+
+// SetRateLimit sets the rate limit of the group with the given key. A limit with a Rate of zero
+// or less removes the group's rate limit.
+func (q *fairQueue) SetRateLimit(key string, limit RateLimit, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	g := q.group(key)
+	switch {
+	case limit.Rate <= 0:
+		g.unthrottle(now)
+		g.limiter = nil
+	case g.limiter == nil:
+		g.limiter = newLimiter(limit, now)
+	default:
+		// Close the current period of throttling at the old rate.
+		if !g.throttledSince.IsZero() {
+			g.unthrottle(now)
+			g.throttle(now)
+		}
+		g.limiter.set(limit, now)
+	}
+	q.prune(key)
+}
+
+// ThrottledUntil returns the earliest time at which a group whose queued tasks are held back by its
+// rate limit may dispatch one, and false if there is no such group.
+func (q *fairQueue) ThrottledUntil(now time.Time) (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var until time.Time
+	for _, g := range q.groups {
+		if g.queue.Len() == 0 || g.allow(now) {
+			continue
+		}
+		if ready := g.limiter.readyAt(); until.IsZero() || ready.Before(until) {
+			until = ready
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// Remove removes a specific task from the queue, and returns false if it was not queued.
+func (q *fairQueue) Remove(t *task.Task) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, queued := q.entries[t]
+	if !queued {
+		return false
+	}
+	delete(q.entries, t)
+	removed := e.group.queue.Remove(t)
+	q.prune(t.Group())
+	return removed
+}
+
+// Contains returns true if the task is queued.
+func (q *fairQueue) Contains(t *task.Task) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, queued := q.entries[t]
+	return queued
+}
+
+// Tasks returns the queued tasks in the order they were pushed.
+func (q *fairQueue) Tasks() []*task.Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.tasks()
+}
+
+// tasks returns the queued tasks in the order they were pushed. It must be called with q.mu held.
+func (q *fairQueue) tasks() []*task.Task {
+	tasks := make([]*task.Task, 0, len(q.entries))
+	for t := range q.entries {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return q.entries[tasks[i]].seq < q.entries[tasks[j]].seq
+	})
+	return tasks
+}
+
+// UpdatePriority updates the priority of a queued task and reorders it, and returns false if it was not queued.
+func (q *fairQueue) UpdatePriority(t *task.Task, priority task.Priority) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, queued := q.entries[t]
+	if !queued {
+		return false
+	}
+	t.SetPriority(priority)
+	return e.group.queue.Update(t)
+}
+
+// EffectivePriority returns the priority a queued task is currently ordered by within its group,
+// and false if it is not queued. Under policies that do not order by priority, it is the task's priority.
+func (q *fairQueue) EffectivePriority(t *task.Task) (task.Priority, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, queued := q.entries[t]
+	if !queued {
+		return 0, false
+	}
+	if p, ok := e.group.queue.(interface {
+		EffectivePriority(*task.Task) (task.Priority, bool)
+	}); ok {
+		return p.EffectivePriority(t)
+	}
+	return t.Priority(), true
+}
+
+// Stats returns statistics for each group at now, keyed by group.
+func (q *fairQueue) Stats(now time.Time) map[string]GroupStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := make(map[string]GroupStats, len(q.groups))
+	for key, g := range q.groups {
+		st := GroupStats{
+			Weight:     g.weight,
+			Queued:     g.queue.Len(),
+			Dispatched: g.dispatched,
+			Throttled:  g.throttledAt(now),
+		}
+		if g.limiter != nil {
+			st.RateLimit = g.limiter.limit()
+		}
+		if q.dispatched > 0 {
+			st.Share = float64(g.dispatched) / float64(q.dispatched)
+		}
+		stats[key] = st
+	}
+	return stats
+}
@@ -0,0 +1,108 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerFairShare(t *testing.T) {
+	// newBusyScheduler returns a started scheduler with one worker that is busy until release is closed.
+	newBusyScheduler := func(t *testing.T) (*scheduler.Scheduler, chan struct{}) {
+		sch := newScheduler(t, 1)
+
+		release := make(chan struct{})
+		running := make(chan struct{})
+		blocker := task.NewTask("blocker", func(ctx context.Context) error {
+			close(running)
+			<-release
+			return nil
+		}, task.LowPriority)
+		assert.NoError(t, sch.Submit(blocker))
+		<-running
+		return sch, release
+	}
+
+	newGroupTask := func(id, group string, priority task.Priority, started chan<- string) *task.Task {
+		tsk := task.NewTask(id, func(ctx context.Context) error {
+			started <- id
+			return nil
+		}, priority)
+		tsk.SetGroup(group)
+		return tsk
+	}
+
+	t.Run("weighted", func(t *testing.T) {
+		sch, release := newBusyScheduler(t)
+		sch.SetGroupWeight("a", 2)
+
+		started := make(chan string, 9)
+		for _, id := range []string{"a1", "a2", "a3", "a4", "a5", "a6"} {
+			assert.NoError(t, sch.Submit(newGroupTask(id, "a", task.LowPriority, started)))
+		}
+		for _, id := range []string{"b1", "b2", "b3"} {
+			assert.NoError(t, sch.Submit(newGroupTask(id, "b", task.LowPriority, started)))
+		}
+
+		stats := sch.GroupStats()
+		assert.Equal(t, 6, stats["a"].Queued)
+		assert.Equal(t, 3, stats["b"].Queued)
+		assert.Equal(t, 2, stats["a"].Weight)
+		assert.Equal(t, 1, stats["b"].Weight)
+
+		close(release)
+		var order []string
+		for i := 0; i < 9; i++ {
+			order = append(order, <-started)
+		}
+		assert.Equal(t, []string{"a1", "a2", "b1", "a3", "a4", "b2", "a5", "a6", "b3"}, order)
+
+		stats = sch.GroupStats()
+		assert.Equal(t, uint64(6), stats["a"].Dispatched)
+		assert.Equal(t, 0, stats["a"].Queued)
+		assert.InDelta(t, 0.6, stats["a"].Share, 0.001)
+		// Groups with no queued tasks and no settings are dropped.
+		assert.NotContains(t, stats, "b")
+	})
+
+	t.Run("priority first", func(t *testing.T) {
+		sch, release := newBusyScheduler(t)
+		sch.SetGroupWeight("a", 10)
+
+		started := make(chan string, 3)
+		assert.NoError(t, sch.Submit(newGroupTask("a1", "a", task.LowPriority, started)))
+		assert.NoError(t, sch.Submit(newGroupTask("a2", "a", task.LowPriority, started)))
+		assert.NoError(t, sch.Submit(newGroupTask("b1", "b", task.HighPriority, started)))
+
+		close(release)
+		assert.Equal(t, "b1", <-started)
+		assert.Equal(t, "a1", <-started)
+		assert.Equal(t, "a2", <-started)
+	})
+
+	t.Run("drops idle groups", func(t *testing.T) {
+		sch, release := newBusyScheduler(t)
+		sch.SetGroupWeight("weighted", 2)
+
+		started := make(chan string, 7)
+		for _, id := range []string{"a1", "b1", "c1", "d1", "a2", "c2", "d2"} {
+			assert.NoError(t, sch.Submit(newGroupTask(id, id[:1], task.LowPriority, started)))
+		}
+
+		close(release)
+		var order []string
+		for i := 0; i < 7; i++ {
+			order = append(order, <-started)
+		}
+		// Dropping b once it is empty keeps the round robin on c.
+		assert.Equal(t, []string{"a1", "b1", "c1", "d1", "a2", "c2", "d2"}, order)
+
+		stats := sch.GroupStats()
+		assert.Len(t, stats, 1)
+		assert.Equal(t, 2, stats["weighted"].Weight)
+	})
+}
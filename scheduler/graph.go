@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CSXL/go-agent/task"
+)
+
+var (
+	// ErrDependencyCycle is returned when the dependencies of submitted tasks form a cycle.
+	ErrDependencyCycle = errors.New("dependency cycle")
+
+	// ErrUnknownDependency is returned when a task depends on a task that has not been submitted.
+	ErrUnknownDependency = errors.New("unknown dependency")
+)
+
+// visit states used when walking the dependency graph.
+const (
+	unvisited = iota
+	visiting
+	visited
+)
+
+// validate checks that the given tasks can be submitted together, and returns them ordered so that
+// every task follows its dependencies. It must be called with s.mu held.
+func (s *Scheduler) validate(tasks []*task.Task) ([]*task.Task, error) {
+	batch := make(map[*task.Task]bool, len(tasks))
+	for _, t := range tasks {
+		if _, submitted := s.submitted[t]; submitted || !t.SubmittedAt().IsZero() {
+			return nil, fmt.Errorf("%w: %q", task.ErrAlreadySubmitted, t.ID())
+		}
+		batch[t] = true
+	}
+
+	for _, t := range tasks {
+		if err := s.resourceMgr.Satisfiable(requests(t)); err != nil {
+			return nil, fmt.Errorf("task %q: %w", t.ID(), err)
+		}
+		for _, dep := range t.Dependencies() {
+			// Completed dependencies are no longer tracked, but their outcome is known.
+			_, submitted := s.submitted[dep]
+			completed := dep.State().IsTerminal() && !dep.SubmittedAt().IsZero()
+			if !submitted && !completed && !batch[dep] {
+				return nil, fmt.Errorf("%w: task %q depends on %q", ErrUnknownDependency, t.ID(), dep.ID())
+			}
+		}
+	}
+
+	order := make([]*task.Task, 0, len(tasks))
+	states := make(map[*task.Task]int)
+	var path []*task.Task
+	var visit func(t *task.Task) error
+	visit = func(t *task.Task) error {
+		switch states[t] {
+		case visiting:
+			return cycleError(path, t)
+		case visited:
+			return nil
+		}
+
+		states[t] = visiting
+		path = append(path, t)
+		for _, dep := range t.Dependencies() {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		states[t] = visited
+
+		if batch[t] {
+			order = append(order, t)
+		}
+		return nil
+	}
+
+	for _, t := range tasks {
+		if err := visit(t); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// cycleError returns an error naming the cycle that closes when the last task in path depends on t.
+func cycleError(path []*task.Task, t *task.Task) error {
+	start := 0
+	for i, p := range path {
+		if p == t {
+			start = i
+			break
+		}
+	}
+
+	ids := make([]string, 0, len(path)-start+1)
+	for _, p := range path[start:] {
+		ids = append(ids, p.ID())
+	}
+	ids = append(ids, t.ID())
+	return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(ids, " -> "))
+}
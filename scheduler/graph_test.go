@@ -0,0 +1,107 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func newGraphTask(id string, deps ...*task.Task) *task.Task {
+	tsk := task.NewTask(id, func(ctx context.Context) error {
+		return nil
+	}, task.LowPriority)
+	for _, dep := range deps {
+		tsk.AddDependency(dep)
+	}
+	return tsk
+}
+
+func TestSchedulerGraphValidation(t *testing.T) {
+	t.Run("cycle", func(t *testing.T) {
+		sch := newScheduler(t, 2)
+
+		a := newGraphTask("a")
+		b := newGraphTask("b", a)
+		c := newGraphTask("c", b)
+		a.AddDependency(c)
+
+		err := sch.SubmitGraph(a, b, c)
+
+		assert.ErrorIs(t, err, scheduler.ErrDependencyCycle)
+		assert.Contains(t, err.Error(), "a -> c -> b -> a")
+		assert.Equal(t, task.Pending, a.State())
+		assert.True(t, a.SubmittedAt().IsZero())
+	})
+
+	t.Run("self dependency", func(t *testing.T) {
+		sch := newScheduler(t, 2)
+
+		a := newGraphTask("a")
+		a.AddDependency(a)
+
+		err := sch.Submit(a)
+
+		assert.ErrorIs(t, err, scheduler.ErrDependencyCycle)
+		assert.Contains(t, err.Error(), "a -> a")
+	})
+
+	t.Run("unknown dependency", func(t *testing.T) {
+		sch := newScheduler(t, 2)
+
+		a := newGraphTask("a")
+		b := newGraphTask("b", a)
+
+		err := sch.Submit(b)
+
+		assert.ErrorIs(t, err, scheduler.ErrUnknownDependency)
+		assert.Contains(t, err.Error(), `"b" depends on "a"`)
+	})
+
+	t.Run("already submitted", func(t *testing.T) {
+		sch := newScheduler(t, 2)
+
+		a := newGraphTask("a")
+		assert.NoError(t, sch.Submit(a))
+
+		err := sch.Submit(a)
+
+		assert.ErrorIs(t, err, task.ErrAlreadySubmitted)
+	})
+
+	t.Run("atomic", func(t *testing.T) {
+		sch := newScheduler(t, 2)
+
+		a := newGraphTask("a")
+		b := newGraphTask("b", a, newGraphTask("missing"))
+
+		err := sch.SubmitGraph(a, b)
+
+		assert.ErrorIs(t, err, scheduler.ErrUnknownDependency)
+		_, err = sch.Task("a")
+		assert.ErrorIs(t, err, scheduler.ErrTaskNotFound)
+		assert.True(t, a.SubmittedAt().IsZero())
+	})
+
+	t.Run("graph", func(t *testing.T) {
+		sch := newScheduler(t, 2)
+
+		root := newGraphTask("root")
+		assert.NoError(t, sch.Submit(root))
+
+		a := newGraphTask("a", root)
+		b := newGraphTask("b", root)
+		join := newGraphTask("join", a, b)
+
+		err := sch.SubmitGraph(join, b, a)
+
+		assert.NoError(t, err)
+		assert.NoError(t, join.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, join.State())
+		assert.False(t, a.FinishedAt().After(join.StartedAt()))
+		assert.False(t, b.FinishedAt().After(join.StartedAt()))
+	})
+}
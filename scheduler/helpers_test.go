@@ -0,0 +1,35 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/executor"
+	"github.com/CSXL/go-agent/resource"
+	"github.com/CSXL/go-agent/scheduler"
+)
+
+// epoch is the time at which the fake clocks of schedulers created by newFakeScheduler start.
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newScheduler returns a started scheduler with the given number of workers, after applying configure to it,
+// and stops it when the test completes.
+func newScheduler(t *testing.T, workers int, configure ...func(*scheduler.Scheduler)) *scheduler.Scheduler {
+	t.Helper()
+	sch := scheduler.NewScheduler(executor.NewExecutor(workers), resource.NewManager())
+	for _, fn := range configure {
+		fn(sch)
+	}
+	sch.Start()
+	t.Cleanup(sch.Stop)
+	return sch
+}
+
+// newFakeScheduler is like newScheduler, but the scheduler uses the returned fake clock, starting at epoch.
+func newFakeScheduler(t *testing.T, workers int, configure ...func(*scheduler.Scheduler)) (*scheduler.Scheduler, *clock.Fake) {
+	t.Helper()
+	c := clock.NewFake(epoch)
+	setClock := func(sch *scheduler.Scheduler) { sch.SetClock(c) }
+	return newScheduler(t, workers, append([]func(*scheduler.Scheduler){setClock}, configure...)...), c
+}
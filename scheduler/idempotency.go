@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/task"
+)
+
+// SetIdempotencyWindow sets how long after a task with an idempotency key completes later submissions
+// with the same key still share its outcome instead of running. Submissions made while the task has not
+// completed always share its outcome. A window of zero or less, the default, only coalesces those.
+func (s *Scheduler) SetIdempotencyWindow(window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idempotencyWindow = window
+}
+
+// idempotent is the task submitted for an idempotency key, and when it completed.
+type idempotent struct {
+	task   *task.Task
+	doneAt time.Time
+	expiry clock.Timer
+}
+
+// duplicates returns the tasks in order that share the execution of an earlier task with the same
+// idempotency key, mapped to that task. It must be called with s.mu held.
+func (s *Scheduler) duplicates(order []*task.Task) map[*task.Task]*task.Task {
+	var dups map[*task.Task]*task.Task
+	seen := make(map[string]*task.Task)
+	for _, t := range order {
+		key := t.IdempotencyKey()
+		if key == "" {
+			continue
+		}
+		original := seen[key]
+		if original == nil {
+			original = s.original(key)
+		}
+		if original == nil {
+			seen[key] = t
+			continue
+		}
+		if dups == nil {
+			dups = make(map[*task.Task]*task.Task)
+		}
+		dups[t] = original
+	}
+	return dups
+}
+
+// original returns the task whose outcome is shared by submissions with the given idempotency key,
+// or nil if there is none. It must be called with s.mu held.
+func (s *Scheduler) original(key string) *task.Task {
+	e, exists := s.idempotent[key]
+	if !exists {
+		return nil
+	}
+	if !e.task.State().IsTerminal() {
+		return e.task
+	}
+	// The task may have completed before its completion was recorded.
+	now := s.clock.Now()
+	doneAt := e.doneAt
+	if doneAt.IsZero() {
+		doneAt = now
+	}
+	if now.Before(doneAt.Add(s.idempotencyWindow)) {
+		return e.task
+	}
+	return nil
+}
+
+// remember records t as the task for its idempotency key, if it has one. It must be called with s.mu held.
+func (s *Scheduler) remember(t *task.Task) {
+	key := t.IdempotencyKey()
+	if key == "" {
+		return
+	}
+	if e, exists := s.idempotent[key]; exists && e.expiry != nil {
+		e.expiry.Stop()
+	}
+	e := &idempotent{task: t}
+	s.idempotent[key] = e
+	t.Watch(func(tr task.Transition) {
+		if tr.To.IsTerminal() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.forget(key, e)
+		}
+	})
+}
+
+// forget records that the task for an idempotency key has completed, and removes it once the
+// idempotency window has passed. It must be called with s.mu held.
+func (s *Scheduler) forget(key string, e *idempotent) {
+	if s.idempotent[key] != e {
+		return
+	}
+	e.doneAt = s.clock.Now()
+	if s.idempotencyWindow <= 0 {
+		delete(s.idempotent, key)
+		return
+	}
+	e.expiry = s.clock.AfterFunc(s.idempotencyWindow, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.idempotent[key] == e {
+			delete(s.idempotent, key)
+		}
+	})
+}
+
+// attach records t as submitted and makes it share the execution of original. It must be called with s.mu held.
+func (s *Scheduler) attach(t, original *task.Task) error {
+	if err := t.MarkSubmittedAt(s.clock.Now()); err != nil {
+		return err
+	}
+	s.track(t)
+	t.Follow(original)
+	return nil
+}
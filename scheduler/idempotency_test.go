@@ -0,0 +1,121 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerIdempotency(t *testing.T) {
+	// newKeyed returns a task with the given idempotency key that counts its runs and waits for release.
+	newKeyed := func(id, key string, runs *int32, release <-chan struct{}, err error) *task.Task {
+		tsk := task.NewTask(id, func(ctx context.Context) error {
+			atomic.AddInt32(runs, 1)
+			<-release
+			return err
+		}, task.LowPriority)
+		tsk.SetIdempotencyKey(key)
+		return tsk
+	}
+
+	closed := make(chan struct{})
+	close(closed)
+
+	t.Run("coalesces in-flight submissions", func(t *testing.T) {
+		sch, _ := newFakeScheduler(t, 2)
+
+		var runs int32
+		release := make(chan struct{})
+		failure := errors.New("downstream unavailable")
+		first := newKeyed("first", "webhook", &runs, release, failure)
+		second := newKeyed("second", "webhook", &runs, release, failure)
+		assert.NoError(t, sch.Submit(first))
+		assert.Eventually(t, func() bool { return first.State() == task.Running }, time.Second, time.Millisecond)
+		assert.NoError(t, sch.Submit(second))
+
+		close(release)
+		assert.NoError(t, second.Wait(context.Background()))
+		assert.Equal(t, task.Failed, second.State())
+		assert.ErrorIs(t, second.Err(), failure)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	})
+
+	t.Run("same graph", func(t *testing.T) {
+		sch, _ := newFakeScheduler(t, 2)
+
+		var runs int32
+		first := newKeyed("first", "webhook", &runs, closed, nil)
+		second := newKeyed("second", "webhook", &runs, closed, nil)
+		dependent := task.NewTask("dependent", func(ctx context.Context) error { return nil }, task.LowPriority)
+		dependent.AddDependency(second)
+		assert.NoError(t, sch.SubmitGraph(first, second, dependent))
+
+		assert.NoError(t, dependent.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, second.State())
+		assert.Equal(t, task.Succeeded, dependent.State())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	})
+
+	t.Run("completed keys within the window", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+		sch.SetIdempotencyWindow(time.Minute)
+
+		var runs int32
+		first := newKeyed("first", "webhook", &runs, closed, nil)
+		assert.NoError(t, sch.Submit(first))
+		assert.NoError(t, first.Wait(context.Background()))
+
+		second := newKeyed("second", "webhook", &runs, closed, nil)
+		assert.NoError(t, sch.Submit(second))
+		assert.Equal(t, task.Succeeded, second.State())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+		// The key is forgotten once the window has passed since the first task completed.
+		assert.Eventually(t, func() bool {
+			c.Advance(time.Minute)
+			third := newKeyed("third", "webhook", &runs, closed, nil)
+			assert.NoError(t, sch.Submit(third))
+			assert.NoError(t, third.Wait(context.Background()))
+			return atomic.LoadInt32(&runs) == 2
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("completed keys without a window", func(t *testing.T) {
+		sch, _ := newFakeScheduler(t, 2)
+
+		var runs int32
+		first := newKeyed("first", "webhook", &runs, closed, nil)
+		assert.NoError(t, sch.Submit(first))
+		assert.NoError(t, first.Wait(context.Background()))
+
+		second := newKeyed("second", "webhook", &runs, closed, nil)
+		assert.NoError(t, sch.Submit(second))
+		assert.NoError(t, second.Wait(context.Background()))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+	})
+
+	t.Run("duplicates need no room", func(t *testing.T) {
+		sch, _ := newFakeScheduler(t, 2)
+		sch.SetQueueLimit(1, scheduler.OverflowFailFast)
+
+		var runs int32
+		release := make(chan struct{})
+		defer close(release)
+		for i, id := range []string{"busy-1", "busy-2"} {
+			assert.NoError(t, sch.Submit(newKeyed(id, id, &runs, release, nil)))
+			assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == int32(i+1) }, time.Second, time.Millisecond)
+		}
+
+		queued := newKeyed("queued", "webhook", &runs, release, nil)
+		assert.NoError(t, sch.Submit(queued))
+		assert.ErrorIs(t, sch.Submit(task.NewTask("other", nil, task.LowPriority)), scheduler.ErrQueueFull)
+		assert.NoError(t, sch.Submit(newKeyed("duplicate", "webhook", &runs, release, nil)))
+	})
+}
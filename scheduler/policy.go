@@ -0,0 +1,282 @@
+package scheduler
+
+import (
+	"container/heap"
+	"container/list"
+	"math"
+	"time"
+
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/priority_queue"
+	"github.com/CSXL/go-agent/task"
+)
+
+// Policy decides the order in which the ready tasks of a group are dispatched. The scheduler keeps one
+// Policy per group, created by the factory passed to SetPolicy, and only calls it with s.mu held.
+type Policy interface {
+	// Enqueue adds a task. Enqueuing a task that is already queued has no effect.
+	Enqueue(t *task.Task)
+
+	// Dequeue removes and returns the next task to dispatch, or nil if there are none.
+	Dequeue() *task.Task
+
+	// Peek returns the next task to dispatch without removing it, or nil if there are none.
+	Peek() *task.Task
+
+	// Remove removes a specific task, and returns false if it was not queued.
+	Remove(t *task.Task) bool
+
+	// Update moves a queued task to its place after the attributes it is ordered by have changed,
+	// and returns false if it was not queued.
+	Update(t *task.Task) bool
+
+	// Len returns the number of queued tasks.
+	Len() int
+
+	// Urgency returns how urgent a queued task is compared with the tasks of other groups. The next task of the
+	// group with the most urgent one is dispatched first, and groups whose next tasks are equally urgent share
+	// workers by weight.
+	Urgency(t *task.Task) int64
+}
+
+// SetPolicy sets the factory for the policies that order each group's ready tasks. Tasks that are already
+// queued are reordered under the new policy. The default is NewPriorityPolicy.
+func (s *Scheduler) SetPolicy(newPolicy func() Policy) {
+	s.queue.SetPolicy(newPolicy)
+}
+
+// priorityPolicy is a Policy that dispatches tasks in order of priority, and in the order they
+// were enqueued within a priority.
+type priorityPolicy struct {
+	queue *priority_queue.PriorityQueue
+}
+
+// NewPriorityPolicy returns a Policy that dispatches tasks strictly in order of their effective priority,
+// including any aging, and in the order they were enqueued within a priority. A task's urgency is its
+// effective priority, so groups share workers between tasks of the same priority.
+func NewPriorityPolicy() Policy {
+	return &priorityPolicy{queue: priority_queue.NewPriorityQueue()}
+}
+
+func (p *priorityPolicy) Enqueue(t *task.Task) {
+	p.queue.Push(t)
+}
+
+func (p *priorityPolicy) Dequeue() *task.Task {
+	t, _ := p.queue.Pop().(*task.Task)
+	return t
+}
+
+func (p *priorityPolicy) Peek() *task.Task {
+	return p.queue.Peek()
+}
+
+func (p *priorityPolicy) Remove(t *task.Task) bool {
+	return p.queue.Remove(t)
+}
+
+func (p *priorityPolicy) Update(t *task.Task) bool {
+	return p.queue.UpdatePriority(t, t.Priority())
+}
+
+func (p *priorityPolicy) Len() int {
+	return p.queue.Len()
+}
+
+func (p *priorityPolicy) Urgency(t *task.Task) int64 {
+	priority, _ := p.queue.EffectivePriority(t)
+	return int64(priority)
+}
+
+// SetAging sets the interval by which waiting tasks gain priority.
+func (p *priorityPolicy) SetAging(interval time.Duration) {
+	p.queue.SetAging(interval)
+}
+
+// SetClock sets the clock that measures how long tasks have waited for aging.
+func (p *priorityPolicy) SetClock(c clock.Clock) {
+	p.queue.SetClock(c)
+}
+
+// EffectivePriority returns the priority a queued task is currently ordered by, and false if it is not queued.
+func (p *priorityPolicy) EffectivePriority(t *task.Task) (task.Priority, bool) {
+	return p.queue.EffectivePriority(t)
+}
+
+// fifoPolicy is a Policy that dispatches tasks in the order they were enqueued.
+type fifoPolicy struct {
+	order    *list.List
+	elements map[*task.Task]*list.Element
+}
+
+// NewFIFOPolicy returns a Policy that dispatches tasks in the order they were enqueued, ignoring priorities.
+// All tasks are equally urgent, so groups share workers by weight regardless of priority.
+func NewFIFOPolicy() Policy {
+	return &fifoPolicy{order: list.New(), elements: make(map[*task.Task]*list.Element)}
+}
+
+func (p *fifoPolicy) Enqueue(t *task.Task) {
+	if _, queued := p.elements[t]; queued {
+		return
+	}
+	p.elements[t] = p.order.PushBack(t)
+}
+
+func (p *fifoPolicy) Dequeue() *task.Task {
+	t := p.Peek()
+	if t != nil {
+		p.Remove(t)
+	}
+	return t
+}
+
+func (p *fifoPolicy) Peek() *task.Task {
+	front := p.order.Front()
+	if front == nil {
+		return nil
+	}
+	return front.Value.(*task.Task)
+}
+
+func (p *fifoPolicy) Remove(t *task.Task) bool {
+	e, queued := p.elements[t]
+	if !queued {
+		return false
+	}
+	p.order.Remove(e)
+	delete(p.elements, t)
+	return true
+}
+
+func (p *fifoPolicy) Update(t *task.Task) bool {
+	_, queued := p.elements[t]
+	return queued
+}
+
+func (p *fifoPolicy) Len() int {
+	return p.order.Len()
+}
+
+func (p *fifoPolicy) Urgency(*task.Task) int64 {
+	return 0
+}
+
+// edfPolicy is a Policy that dispatches tasks in order of their deadlines.
+type edfPolicy struct {
+	items deadlineHeap
+	index map[*task.Task]*deadlineItem
+	seq   uint64
+}
+
+// NewEDFPolicy returns a Policy that dispatches the task with the earliest deadline first, and tasks with
+// equal deadlines in the order they were enqueued. Tasks without a deadline are dispatched after all tasks
+// with one. A task's urgency is determined by its deadline, so groups share workers between tasks with the
+// same deadline.
+func NewEDFPolicy() Policy {
+	return &edfPolicy{index: make(map[*task.Task]*deadlineItem)}
+}
+
+func (p *edfPolicy) Enqueue(t *task.Task) {
+	if _, queued := p.index[t]; queued {
+		return
+	}
+	p.seq++
+	it := &deadlineItem{task: t, deadline: t.Deadline(), seq: p.seq}
+	p.index[t] = it
+	heap.Push(&p.items, it)
+}
+
+func (p *edfPolicy) Dequeue() *task.Task {
+	if len(p.items) == 0 {
+		return nil
+	}
+	it := heap.Pop(&p.items).(*deadlineItem)
+	delete(p.index, it.task)
+	return it.task
+}
+
+func (p *edfPolicy) Peek() *task.Task {
+	if len(p.items) == 0 {
+		return nil
+	}
+	return p.items[0].task
+}
+
+func (p *edfPolicy) Remove(t *task.Task) bool {
+	it, queued := p.index[t]
+	if !queued {
+		return false
+	}
+	heap.Remove(&p.items, it.index)
+	delete(p.index, t)
+	return true
+}
+
+func (p *edfPolicy) Update(t *task.Task) bool {
+	it, queued := p.index[t]
+	if !queued {
+		return false
+	}
+	it.deadline = t.Deadline()
+	heap.Fix(&p.items, it.index)
+	return true
+}
+
+func (p *edfPolicy) Len() int {
+	return len(p.items)
+}
+
+func (p *edfPolicy) Urgency(t *task.Task) int64 {
+	it, queued := p.index[t]
+	if !queued || it.deadline.IsZero() {
+		return math.MinInt64
+	}
+	return -it.deadline.UnixNano()
+}
+
+// deadlineItem is a task in an edfPolicy, along with the deadline it is ordered by.
+type deadlineItem struct {
+	task     *task.Task
+	deadline time.Time
+	seq      uint64
+	index    int
+}
+
+// deadlineHeap implements heap.Interface for deadline items, earliest deadline first.
+type deadlineHeap []*deadlineItem
+
+func (h deadlineHeap) Len() int {
+	return len(h)
+}
+
+func (h deadlineHeap) Less(i, j int) bool {
+	di, dj := h[i].deadline, h[j].deadline
+	if di.IsZero() != dj.IsZero() {
+		return dj.IsZero()
+	}
+	if !di.Equal(dj) {
+		return di.Before(dj)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *deadlineHeap) Push(x interface{}) {
+	it := x.(*deadlineItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return it
+}
@@ -0,0 +1,221 @@
+package scheduler_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestPolicies(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// queued is a task in the model of a policy, along with the order it was enqueued in.
+	type queued struct {
+		task *task.Task
+		seq  int
+	}
+
+	// check runs random operations against a policy, and verifies after every operation that it holds
+	// the same tasks as a model, and that it dispatches first a task that no other queued task should precede.
+	check := func(t *testing.T, newPolicy func() scheduler.Policy, before func(a, b queued) bool) {
+		property := func(seed int64) bool {
+			rng := rand.New(rand.NewSource(seed))
+			randomize := func(tsk *task.Task) {
+				tsk.SetPriority(task.Priority(rng.Intn(5)))
+				if rng.Intn(4) == 0 {
+					tsk.SetDeadline(time.Time{})
+				} else {
+					tsk.SetDeadline(base.Add(time.Duration(rng.Intn(5)) * time.Minute))
+				}
+			}
+
+			p := newPolicy()
+			var model []queued
+			for i := 0; i < 200; i++ {
+				switch op := rng.Intn(10); {
+				case op < 4:
+					tsk := task.NewTask(fmt.Sprint(i), nil, task.LowPriority)
+					randomize(tsk)
+					p.Enqueue(tsk)
+					p.Enqueue(tsk)
+					model = append(model, queued{task: tsk, seq: i})
+				case op < 5 && len(model) > 0:
+					j := rng.Intn(len(model))
+					if !p.Remove(model[j].task) || p.Remove(model[j].task) {
+						return false
+					}
+					model = append(model[:j], model[j+1:]...)
+				case op < 7 && len(model) > 0:
+					j := rng.Intn(len(model))
+					randomize(model[j].task)
+					if !p.Update(model[j].task) {
+						return false
+					}
+				default:
+					peeked, next := p.Peek(), p.Dequeue()
+					if peeked != next {
+						return false
+					}
+					if len(model) == 0 {
+						if next != nil {
+							return false
+						}
+						continue
+					}
+					j := -1
+					for k, q := range model {
+						if q.task == next {
+							j = k
+						}
+					}
+					if j < 0 {
+						return false
+					}
+					for _, q := range model {
+						if before(q, model[j]) {
+							return false
+						}
+					}
+					model = append(model[:j], model[j+1:]...)
+					if p.Remove(next) || p.Update(next) {
+						return false
+					}
+				}
+				if p.Len() != len(model) {
+					return false
+				}
+			}
+			return true
+		}
+		assert.NoError(t, quick.Check(property, nil))
+	}
+
+	t.Run("priority", func(t *testing.T) {
+		check(t, scheduler.NewPriorityPolicy, func(a, b queued) bool {
+			pa, pb := a.task.Priority(), b.task.Priority()
+			return pa > pb || (pa == pb && a.seq < b.seq)
+		})
+	})
+
+	t.Run("fifo", func(t *testing.T) {
+		check(t, scheduler.NewFIFOPolicy, func(a, b queued) bool {
+			return a.seq < b.seq
+		})
+	})
+
+	t.Run("earliest deadline first", func(t *testing.T) {
+		check(t, scheduler.NewEDFPolicy, func(a, b queued) bool {
+			da, db := a.task.Deadline(), b.task.Deadline()
+			switch {
+			case da.IsZero() != db.IsZero():
+				return db.IsZero()
+			case !da.Equal(db):
+				return da.Before(db)
+			}
+			return a.seq < b.seq
+		})
+	})
+
+	t.Run("urgency", func(t *testing.T) {
+		early := task.NewTask("early", nil, task.LowPriority)
+		early.SetDeadline(base)
+		late := task.NewTask("late", nil, task.HighPriority)
+		late.SetDeadline(base.Add(time.Minute))
+		none := task.NewTask("none", nil, task.HighPriority)
+
+		edf := scheduler.NewEDFPolicy()
+		fifo := scheduler.NewFIFOPolicy()
+		priority := scheduler.NewPriorityPolicy()
+		for _, tsk := range []*task.Task{early, late, none} {
+			edf.Enqueue(tsk)
+			fifo.Enqueue(tsk)
+			priority.Enqueue(tsk)
+		}
+
+		assert.Greater(t, edf.Urgency(early), edf.Urgency(late))
+		assert.Greater(t, edf.Urgency(late), edf.Urgency(none))
+		assert.Equal(t, fifo.Urgency(early), fifo.Urgency(none))
+		assert.Greater(t, priority.Urgency(late), priority.Urgency(early))
+		assert.Equal(t, priority.Urgency(late), priority.Urgency(none))
+	})
+}
+
+func TestSchedulerPolicy(t *testing.T) {
+	now := time.Now()
+
+	// submitFunc submits a task that records when it runs.
+	type submitFunc func(id string, priority task.Priority, deadline time.Time)
+
+	// run submits tasks to a scheduler with a single busy worker, then frees it and returns the order they ran in.
+	run := func(t *testing.T, newPolicy func() scheduler.Policy, setup func(sch *scheduler.Scheduler, submit submitFunc)) []string {
+		sch := newScheduler(t, 1, func(sch *scheduler.Scheduler) { sch.SetPolicy(newPolicy) })
+
+		release := make(chan struct{})
+		blocker := task.NewTask("blocker", func(ctx context.Context) error {
+			<-release
+			return nil
+		}, task.HighPriority)
+		assert.NoError(t, sch.Submit(blocker))
+		assert.Eventually(t, func() bool { return blocker.State() == task.Running }, time.Second, time.Millisecond)
+
+		var mu sync.Mutex
+		var order []string
+		var tasks []*task.Task
+		setup(sch, func(id string, priority task.Priority, deadline time.Time) {
+			tsk := task.NewTask(id, func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, id)
+				return nil
+			}, priority)
+			tsk.SetDeadline(deadline)
+			assert.NoError(t, sch.Submit(tsk))
+			tasks = append(tasks, tsk)
+		})
+
+		close(release)
+		for _, tsk := range tasks {
+			assert.NoError(t, tsk.Wait(context.Background()))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return order
+	}
+
+	t.Run("fifo", func(t *testing.T) {
+		order := run(t, scheduler.NewFIFOPolicy, func(sch *scheduler.Scheduler, submit submitFunc) {
+			submit("low", task.LowPriority, time.Time{})
+			submit("high", task.HighPriority, time.Time{})
+			submit("medium", task.MediumPriority, time.Time{})
+		})
+		assert.Equal(t, []string{"low", "high", "medium"}, order)
+	})
+
+	t.Run("earliest deadline first", func(t *testing.T) {
+		order := run(t, scheduler.NewEDFPolicy, func(sch *scheduler.Scheduler, submit submitFunc) {
+			submit("none", task.HighPriority, time.Time{})
+			submit("late", task.HighPriority, now.Add(time.Hour))
+			submit("soon", task.LowPriority, now.Add(time.Minute))
+		})
+		assert.Equal(t, []string{"soon", "late", "none"}, order)
+	})
+
+	t.Run("switch with queued tasks", func(t *testing.T) {
+		order := run(t, scheduler.NewPriorityPolicy, func(sch *scheduler.Scheduler, submit submitFunc) {
+			submit("low", task.LowPriority, time.Time{})
+			submit("high", task.HighPriority, time.Time{})
+			sch.SetPolicy(scheduler.NewFIFOPolicy)
+			submit("medium", task.MediumPriority, time.Time{})
+		})
+		assert.Equal(t, []string{"low", "high", "medium"}, order)
+	})
+}
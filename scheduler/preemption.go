@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/CSXL/go-agent/task"
+)
+
+// SetPreemption enables preemption: when every worker is busy and a task of higher priority than a running
+// preemptible task is queued, the running task is preempted to free its worker. Its context is canceled with
+// task.ErrPreempted as the cause, and it is queued again to run from the start. A task is preempted at most
+// maxPreemptions times, after which it runs to completion. A maxPreemptions of zero or less disables preemption,
+// which is the default.
+func (s *Scheduler) SetPreemption(maxPreemptions int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxPreemptions = maxPreemptions
+	s.wake.Broadcast()
+}
+
+// victim returns the running task to preempt for the next queued task, or nil if none should be.
+// The lowest-priority candidate is chosen, and among those the one that started most recently.
+// Only one task is preempted at a time. It must be called with s.mu held.
+func (s *Scheduler) victim() *task.Task {
+	if s.maxPreemptions <= 0 || s.preempting != nil {
+		return nil
+	}
+	next := s.queue.Peek(s.clock.Now())
+	if next == nil {
+		return nil
+	}
+
+	var victim *task.Task
+	for t := range s.active {
+		if !t.Preemptible() ||
+			t.Preemptions() >= s.maxPreemptions ||
+			t.State() != task.Running ||
+			t.Priority() >= next.Priority() {
+			continue
+		}
+		if victim == nil ||
+			t.Priority() < victim.Priority() ||
+			(t.Priority() == victim.Priority() && t.StartedAt().After(victim.StartedAt())) {
+			victim = t
+		}
+	}
+	return victim
+}
+
+// preempt preempts a running task. Its worker is freed, and it is queued again, when it completes.
+// It must be called with s.mu held, which is released while the task is preempted.
+func (s *Scheduler) preempt(t *task.Task) {
+	// The task remains the one being preempted until it completes, even if it could not be preempted,
+	// e.g. because it was canceled in the meantime.
+	s.preempting = t
+	subscribers := s.subscribers
+	s.mu.Unlock()
+	defer s.mu.Lock()
+
+	if t.Preempt() {
+		emit(subscribers, Event{
+			Type:   Preempted,
+			TaskID: t.ID(),
+			At:     time.Now(),
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package scheduler_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerPreemption(t *testing.T) {
+	preemption := func(maxPreemptions int) func(*scheduler.Scheduler) {
+		return func(sch *scheduler.Scheduler) { sch.SetPreemption(maxPreemptions) }
+	}
+
+	// submitLow submits a task that runs until release is closed or its context is canceled,
+	// and records the cause of each cancellation, then waits for it to start.
+	submitLow := func(t *testing.T, sch *scheduler.Scheduler, preemptible bool, release <-chan struct{}) (*task.Task, <-chan error) {
+		causes := make(chan error, 2)
+		tsk := task.NewTask("low", func(ctx context.Context) error {
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				causes <- context.Cause(ctx)
+				return ctx.Err()
+			}
+		}, task.LowPriority)
+		tsk.SetPreemptible(preemptible)
+		assert.NoError(t, sch.Submit(tsk))
+		assert.Eventually(t, func() bool { return tsk.State() == task.Running }, time.Second, time.Millisecond)
+		return tsk, causes
+	}
+
+	submitHigh := func(t *testing.T, sch *scheduler.Scheduler, id string) *task.Task {
+		tsk := task.NewTask(id, func(ctx context.Context) error { return nil }, task.HighPriority)
+		assert.NoError(t, sch.Submit(tsk))
+		return tsk
+	}
+
+	t.Run("preempts a lower-priority task", func(t *testing.T) {
+		sch := newScheduler(t, 1, preemption(1))
+		var mu sync.Mutex
+		var events []scheduler.Event
+		sch.Subscribe(func(e scheduler.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		})
+
+		release := make(chan struct{})
+		low, causes := submitLow(t, sch, true, release)
+		high := submitHigh(t, sch, "high")
+
+		assert.NoError(t, high.Wait(context.Background()))
+		assert.Equal(t, task.ErrPreempted, <-causes)
+		assert.Eventually(t, func() bool { return low.State() == task.Running }, time.Second, time.Millisecond)
+		assert.Equal(t, 1, low.Preemptions())
+
+		close(release)
+		assert.NoError(t, low.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, low.State())
+		assert.Equal(t, 2, low.Attempts())
+
+		mu.Lock()
+		defer mu.Unlock()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, scheduler.Preempted, events[0].Type)
+			assert.Equal(t, "low", events[0].TaskID)
+		}
+	})
+
+	t.Run("limited preemptions", func(t *testing.T) {
+		sch := newScheduler(t, 1, preemption(1))
+
+		release := make(chan struct{})
+		low, causes := submitLow(t, sch, true, release)
+		assert.NoError(t, submitHigh(t, sch, "first").Wait(context.Background()))
+		<-causes
+		assert.Eventually(t, func() bool { return low.State() == task.Running }, time.Second, time.Millisecond)
+
+		second := submitHigh(t, sch, "second")
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, task.Ready, second.State())
+		assert.Equal(t, 1, low.Preemptions())
+
+		close(release)
+		assert.NoError(t, second.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, low.State())
+	})
+
+	t.Run("not preemptible", func(t *testing.T) {
+		sch := newScheduler(t, 1, preemption(1))
+
+		release := make(chan struct{})
+		low, _ := submitLow(t, sch, false, release)
+		high := submitHigh(t, sch, "high")
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, task.Ready, high.State())
+
+		close(release)
+		assert.NoError(t, high.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, low.State())
+		assert.Zero(t, low.Preemptions())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		sch := newScheduler(t, 1, preemption(0))
+
+		release := make(chan struct{})
+		low, _ := submitLow(t, sch, true, release)
+		high := submitHigh(t, sch, "high")
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, task.Ready, high.State())
+
+		close(release)
+		assert.NoError(t, high.Wait(context.Background()))
+		assert.Zero(t, low.Preemptions())
+	})
+
+	t.Run("canceled task is not requeued", func(t *testing.T) {
+		sch := newScheduler(t, 1, preemption(1))
+
+		release := make(chan struct{})
+		defer close(release)
+		low, _ := submitLow(t, sch, true, release)
+		assert.NoError(t, sch.Cancel("low", scheduler.ErrCanceled))
+		assert.NoError(t, low.Wait(context.Background()))
+		assert.Equal(t, task.Canceled, low.State())
+		assert.ErrorIs(t, low.Err(), scheduler.ErrCanceled)
+	})
+}
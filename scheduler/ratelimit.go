@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"math"
+	"time"
+)
+
+// RateLimit limits how often the tasks of a group are dispatched, by token bucket: the group earns Rate
+// tokens per second up to Burst, and dispatching a task spends one.
+type RateLimit struct {
+	// Rate is the sustained number of tasks per second that may be dispatched.
+	Rate float64
+
+	// Burst is the number of tasks that may be dispatched at once after the group has been idle.
+	// Values below 1 are treated as 1.
+	Burst int
+}
+
+// SetRateLimit sets the rate limit of a group of tasks, replacing any previous one. Queued tasks of a group
+// that has exhausted its limit wait without holding workers, and tasks of other groups are dispatched in the
+// meantime. A limit with a Rate of zero or less removes the group's rate limit.
+func (s *Scheduler) SetRateLimit(group string, limit RateLimit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue.SetRateLimit(group, limit, s.clock.Now())
+	s.wake.Broadcast()
+}
+
+// armThrottle sets a timer to wake the dispatcher when the next group held back by its rate limit may
+// dispatch a task, replacing any previous one. It must be called with s.mu held.
+func (s *Scheduler) armThrottle() {
+	if s.throttle != nil {
+		s.throttle.Stop()
+		s.throttle = nil
+	}
+	if s.stopped {
+		return
+	}
+	now := s.clock.Now()
+	until, throttled := s.queue.ThrottledUntil(now)
+	if !throttled {
+		return
+	}
+	s.throttle = s.clock.AfterFunc(until.Sub(now), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.wake.Broadcast()
+	})
+}
+
+// limiter is a token bucket. Tokens are earned lazily, so its state only changes when tokens are spent
+// or the limit is changed.
+type limiter struct {
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter creates a limiter with a full bucket.
+func newLimiter(limit RateLimit, now time.Time) *limiter {
+	l := &limiter{last: now}
+	l.set(limit, now)
+	l.tokens = float64(l.burst)
+	return l
+}
+
+// set changes the limiter's rate and burst at now, keeping the tokens earned so far up to the new burst.
+func (l *limiter) set(limit RateLimit, now time.Time) {
+	l.tokens = l.available(now)
+	if now.After(l.last) {
+		l.last = now
+	}
+	l.rate = limit.Rate
+	l.burst = limit.Burst
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+}
+
+// limit returns the limiter's rate and burst.
+func (l *limiter) limit() RateLimit {
+	return RateLimit{Rate: l.rate, Burst: l.burst}
+}
+
+// available returns the number of tokens in the bucket at now.
+func (l *limiter) available(now time.Time) float64 {
+	if !now.After(l.last) {
+		return l.tokens
+	}
+	return math.Min(float64(l.burst), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+}
+
+// allow returns true if a token is available at now. A small tolerance absorbs rounding in readyAt.
+func (l *limiter) allow(now time.Time) bool {
+	return l.available(now) >= 1-1e-6
+}
+
+// take spends a token at now.
+func (l *limiter) take(now time.Time) {
+	l.tokens = l.available(now) - 1
+	if now.After(l.last) {
+		l.last = now
+	}
+}
+
+// readyAt returns the time at which a token is, or was, available.
+func (l *limiter) readyAt() time.Time {
+	if l.tokens >= 1 {
+		return l.last
+	}
+	wait := math.Round((1 - l.tokens) / l.rate * float64(time.Second))
+	return l.last.Add(time.Duration(wait))
+}
@@ -0,0 +1,102 @@
+package scheduler_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerRateLimit(t *testing.T) {
+	submit := func(t *testing.T, sch *scheduler.Scheduler, id, group string, started chan<- string) *task.Task {
+		tsk := task.NewTask(id, func(ctx context.Context) error {
+			started <- id
+			return nil
+		}, task.LowPriority)
+		tsk.SetGroup(group)
+		assert.NoError(t, sch.Submit(tsk))
+		return tsk
+	}
+
+	expectNone := func(t *testing.T, started <-chan string) {
+		select {
+		case id := <-started:
+			t.Fatalf("task %s started unexpectedly", id)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	t.Run("burst and rate", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 4)
+		sch.SetRateLimit("api", scheduler.RateLimit{Rate: 10, Burst: 2})
+
+		started := make(chan string, 5)
+		for i := 1; i <= 5; i++ {
+			submit(t, sch, fmt.Sprintf("api-%d", i), "api", started)
+		}
+		assert.ElementsMatch(t, []string{"api-1", "api-2"}, []string{<-started, <-started})
+		expectNone(t, started)
+
+		for i := 3; i <= 5; i++ {
+			c.Advance(100 * time.Millisecond)
+			assert.Equal(t, fmt.Sprintf("api-%d", i), <-started)
+			expectNone(t, started)
+		}
+
+		stats := sch.GroupStats()["api"]
+		assert.Equal(t, scheduler.RateLimit{Rate: 10, Burst: 2}, stats.RateLimit)
+		assert.Equal(t, uint64(5), stats.Dispatched)
+		assert.Equal(t, 300*time.Millisecond, stats.Throttled)
+	})
+
+	t.Run("other groups keep running", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 1)
+		sch.SetRateLimit("slow", scheduler.RateLimit{Rate: 1, Burst: 1})
+
+		started := make(chan string, 4)
+		submit(t, sch, "slow-1", "slow", started)
+		assert.Equal(t, "slow-1", <-started)
+		slow := submit(t, sch, "slow-2", "slow", started)
+		submit(t, sch, "fast-1", "fast", started)
+		submit(t, sch, "fast-2", "fast", started)
+
+		// The throttled task does not hold the only worker.
+		assert.Equal(t, "fast-1", <-started)
+		assert.Equal(t, "fast-2", <-started)
+		assert.Equal(t, task.Ready, slow.State())
+
+		c.Advance(time.Second)
+		assert.Equal(t, "slow-2", <-started)
+		assert.Zero(t, sch.GroupStats()["fast"].Throttled)
+	})
+
+	t.Run("adjusted at runtime", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+		sch.SetRateLimit("api", scheduler.RateLimit{Rate: 1, Burst: 1})
+
+		started := make(chan string, 4)
+		submit(t, sch, "api-1", "api", started)
+		submit(t, sch, "api-2", "api", started)
+		submit(t, sch, "api-3", "api", started)
+		assert.Equal(t, "api-1", <-started)
+		expectNone(t, started)
+
+		// A faster rate takes effect for tasks that are already waiting, keeping the tokens earned so far.
+		c.Advance(250 * time.Millisecond)
+		sch.SetRateLimit("api", scheduler.RateLimit{Rate: 3, Burst: 1})
+		c.Advance(250 * time.Millisecond)
+		assert.Equal(t, "api-2", <-started)
+
+		sch.SetRateLimit("api", scheduler.RateLimit{})
+		assert.Equal(t, "api-3", <-started)
+
+		stats := sch.GroupStats()["api"]
+		assert.Equal(t, scheduler.RateLimit{}, stats.RateLimit)
+		assert.Equal(t, 500*time.Millisecond, stats.Throttled)
+	})
+}
@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/cron"
+	"github.com/CSXL/go-agent/task"
+)
+
+var (
+	// ErrJobExists is returned when a recurring job is added with the ID of an existing job.
+	ErrJobExists = errors.New("job already exists")
+
+	// ErrJobNotFound is returned when a job ID does not match any recurring job.
+	ErrJobNotFound = errors.New("job not found")
+)
+
+// OverlapPolicy determines what happens when a recurring job is due while its previous run has not finished.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the run.
+	OverlapSkip OverlapPolicy = iota
+
+	// OverlapQueue submits the run to start once the previous run has finished, whatever its outcome.
+	OverlapQueue
+
+	// OverlapAllow submits the run to start alongside the previous run.
+	OverlapAllow
+)
+
+// String returns the name of the overlap policy.
+func (p OverlapPolicy) String() string {
+	switch p {
+	case OverlapSkip:
+		return "skip"
+	case OverlapQueue:
+		return "queue"
+	case OverlapAllow:
+		return "allow"
+	default:
+		return "unknown"
+	}
+}
+
+// Job describes work that is submitted as a fresh task each time its schedule comes due.
+type Job struct {
+	// ID identifies the job. Each run is a task with the ID "<job ID>#<run number>", starting from 1.
+	ID string
+
+	// Schedule determines when the job runs, e.g. a schedule returned by cron.Parse or cron.Every.
+	Schedule cron.Schedule
+
+	// Func is the function each run executes.
+	Func func(context.Context) error
+
+	// Priority is the priority of each run.
+	Priority task.Priority
+
+	// Overlap determines what happens when a run is due while the previous run has not finished.
+	Overlap OverlapPolicy
+
+	// Jitter delays each run by a random duration of up to this much, to spread out jobs due at the same time.
+	Jitter time.Duration
+}
+
+// JobInfo describes the state of a recurring job.
+type JobInfo struct {
+	// ID identifies the job.
+	ID string
+
+	// Next is the time the job is next due, or the zero time if its schedule has ended.
+	Next time.Time
+
+	// Runs is the number of runs that have been submitted.
+	Runs int
+
+	// Skipped is the number of runs that were skipped because the previous run had not finished.
+	Skipped int
+
+	// Err is the error from submitting the most recent run, or nil if it was submitted.
+	Err error
+}
+
+// job is a recurring job added to the scheduler.
+type job struct {
+	Job
+	next    time.Time
+	timer   clock.Timer
+	last    *task.Task
+	runs    int
+	skipped int
+	err     error
+}
+
+// AddJob adds a recurring job, which is first due at its schedule's next time after now.
+// It returns ErrJobExists if a job with the same ID has already been added.
+func (s *Scheduler) AddJob(j Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[j.ID]; exists {
+		return fmt.Errorf("%w: %q", ErrJobExists, j.ID)
+	}
+	rj := &job{Job: j, next: j.Schedule.Next(s.clock.Now())}
+	s.jobs[j.ID] = rj
+	s.armJob(rj)
+	return nil
+}
+
+// RemoveJob stops a recurring job from running again. Runs that have already been submitted are not affected.
+func (s *Scheduler) RemoveJob(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, exists := s.jobs[id]
+	if !exists {
+		return ErrJobNotFound
+	}
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	delete(s.jobs, id)
+	return nil
+}
+
+// Jobs returns the state of each recurring job, in the order they are next due. Jobs whose schedules have ended are last.
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		infos = append(infos, JobInfo{ID: j.ID, Next: j.next, Runs: j.runs, Skipped: j.skipped, Err: j.err})
+	}
+	sort.Slice(infos, func(a, b int) bool {
+		na, nb := infos[a].Next, infos[b].Next
+		if na.IsZero() != nb.IsZero() {
+			return nb.IsZero()
+		}
+		if !na.Equal(nb) {
+			return na.Before(nb)
+		}
+		return infos[a].ID < infos[b].ID
+	})
+	return infos
+}
+
+// armJob sets j's timer to fire when it is next due. It must be called with s.mu held.
+func (s *Scheduler) armJob(j *job) {
+	if j.next.IsZero() || s.stopped {
+		j.timer = nil
+		return
+	}
+	due := j.next
+	j.timer = s.clock.AfterFunc(due.Sub(s.clock.Now()), func() {
+		s.runJob(j, due)
+	})
+}
+
+// runJob submits a run of j that was due at the given time, according to its overlap policy, and schedules the next run.
+func (s *Scheduler) runJob(j *job, due time.Time) {
+	s.mu.Lock()
+	if s.jobs[j.ID] != j || s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	j.next = j.Schedule.Next(s.clock.Now())
+	s.armJob(j)
+
+	prev := j.last
+	overlapping := prev != nil && !prev.State().IsTerminal()
+	if overlapping && j.Overlap == OverlapSkip {
+		j.skipped++
+		s.mu.Unlock()
+		return
+	}
+	j.runs++
+	t := task.NewTask(fmt.Sprintf("%s#%d", j.ID, j.runs), j.Func, j.Priority)
+	if overlapping && j.Overlap == OverlapQueue {
+		t.AddDependencyWithPolicy(prev, task.RunOnFailure)
+	}
+	j.last = t
+	s.mu.Unlock()
+
+	at := due
+	if j.Jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(j.Jitter))))
+	}
+	err := s.SubmitAt(t, at)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.err = err
+	if err != nil && j.last == t {
+		// The run was never submitted, so it cannot overlap with the next one.
+		j.last = prev
+	}
+}
+
+// stopJobs stops every recurring job's timer. It must be called with s.mu held.
+func (s *Scheduler) stopJobs() {
+	for _, j := range s.jobs {
+		if j.timer != nil {
+			j.timer.Stop()
+			j.timer = nil
+		}
+	}
+}
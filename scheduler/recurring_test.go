@@ -0,0 +1,173 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/cron"
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerRecurringJobs(t *testing.T) {
+	expectNoRun := func(t *testing.T, runs <-chan struct{}) {
+		select {
+		case <-runs:
+			t.Fatal("job ran unexpectedly")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	t.Run("cron schedule", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+
+		schedule, err := cron.ParseInLocation("0 3 * * *", time.UTC)
+		assert.NoError(t, err)
+		runs := make(chan struct{}, 2)
+		assert.NoError(t, sch.AddJob(scheduler.Job{
+			ID:       "nightly",
+			Schedule: schedule,
+			Func: func(ctx context.Context) error {
+				runs <- struct{}{}
+				return nil
+			},
+		}))
+		assert.NoError(t, sch.AddJob(scheduler.Job{
+			ID:       "hourly",
+			Schedule: cron.Every(time.Hour),
+			Func:     func(ctx context.Context) error { return nil },
+			Overlap:  scheduler.OverlapAllow,
+		}))
+		assert.ErrorIs(t, sch.AddJob(scheduler.Job{ID: "nightly", Schedule: schedule}), scheduler.ErrJobExists)
+
+		jobs := sch.Jobs()
+		if assert.Len(t, jobs, 2) {
+			assert.Equal(t, "hourly", jobs[0].ID)
+			assert.Equal(t, epoch.Add(time.Hour), jobs[0].Next)
+			assert.Equal(t, "nightly", jobs[1].ID)
+			assert.Equal(t, epoch.Add(3*time.Hour), jobs[1].Next)
+		}
+
+		c.Advance(3 * time.Hour)
+		<-runs
+		tsk, err := sch.Task("nightly#1")
+		assert.NoError(t, err)
+		assert.NoError(t, tsk.Wait(context.Background()))
+
+		c.Advance(24 * time.Hour)
+		<-runs
+		jobs = sch.Jobs()
+		assert.Equal(t, "hourly", jobs[0].ID)
+		assert.Equal(t, 27, jobs[0].Runs)
+		assert.Equal(t, 2, jobs[1].Runs)
+		assert.Equal(t, epoch.Add(51*time.Hour), jobs[1].Next)
+	})
+
+	t.Run("overlap", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+
+		release := make(chan struct{})
+		started := make(chan struct{}, 2)
+		blocking := func(ctx context.Context) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		}
+		for _, policy := range []scheduler.OverlapPolicy{scheduler.OverlapSkip, scheduler.OverlapQueue} {
+			assert.NoError(t, sch.AddJob(scheduler.Job{
+				ID:       policy.String(),
+				Schedule: cron.Every(time.Minute),
+				Func:     blocking,
+				Overlap:  policy,
+			}))
+		}
+
+		c.Advance(time.Minute)
+		<-started
+		<-started
+		c.Advance(time.Minute)
+		expectNoRun(t, started)
+
+		jobs := sch.Jobs()
+		assert.Equal(t, "queue", jobs[0].ID)
+		assert.Equal(t, 2, jobs[0].Runs)
+		assert.Equal(t, 0, jobs[0].Skipped)
+		assert.Equal(t, "skip", jobs[1].ID)
+		assert.Equal(t, 1, jobs[1].Runs)
+		assert.Equal(t, 1, jobs[1].Skipped)
+
+		queued, err := sch.Task("queue#2")
+		assert.NoError(t, err)
+		assert.Equal(t, task.Pending, queued.State())
+
+		close(release)
+		assert.NoError(t, queued.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, queued.State())
+	})
+
+	t.Run("overlap allowed", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+
+		release := make(chan struct{})
+		defer close(release)
+		started := make(chan struct{}, 2)
+		assert.NoError(t, sch.AddJob(scheduler.Job{
+			ID:       "concurrent",
+			Schedule: cron.Every(time.Minute),
+			Func: func(ctx context.Context) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			},
+			Overlap: scheduler.OverlapAllow,
+		}))
+
+		c.Advance(time.Minute)
+		<-started
+		c.Advance(time.Minute)
+		<-started
+	})
+
+	t.Run("jitter", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+
+		runs := make(chan struct{}, 1)
+		assert.NoError(t, sch.AddJob(scheduler.Job{
+			ID:       "jittered",
+			Schedule: cron.Every(time.Hour),
+			Func: func(ctx context.Context) error {
+				runs <- struct{}{}
+				return nil
+			},
+			Jitter: time.Minute,
+		}))
+
+		c.Advance(time.Hour - time.Second)
+		expectNoRun(t, runs)
+		c.Advance(time.Minute + time.Second)
+		<-runs
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 2)
+
+		runs := make(chan struct{}, 1)
+		assert.NoError(t, sch.AddJob(scheduler.Job{
+			ID:       "removed",
+			Schedule: cron.Every(time.Minute),
+			Func: func(ctx context.Context) error {
+				runs <- struct{}{}
+				return nil
+			},
+		}))
+		assert.NoError(t, sch.RemoveJob("removed"))
+		assert.ErrorIs(t, sch.RemoveJob("removed"), scheduler.ErrJobNotFound)
+		assert.Empty(t, sch.Jobs())
+
+		c.Advance(time.Hour)
+		expectNoRun(t, runs)
+	})
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/CSXL/go-agent/resource"
+	"github.com/CSXL/go-agent/task"
+)
+
+// requests returns the resource requests for the requirements of t, or nil if it has none.
+func requests(t *task.Task) []resource.Request {
+	requirements := t.Requirements()
+	if len(requirements) == 0 {
+		return nil
+	}
+	requests := make([]resource.Request, len(requirements))
+	for i, req := range requirements {
+		requests[i] = resource.Request{Name: req.Resource, Units: req.Units}
+	}
+	return requests
+}
+
+// acquire reserves the resources t requires, and returns false if they are not all available.
+// It must be called with s.mu held.
+func (s *Scheduler) acquire(t *task.Task) bool {
+	requests := requests(t)
+	if len(requests) == 0 {
+		return true
+	}
+	if err := s.resourceMgr.AcquireAll(requests); err != nil {
+		return false
+	}
+	s.held[t] = requests
+	return true
+}
+
+// unsatisfiable cancels t if the resources it requires can never be available, e.g. because one has been
+// unregistered since it was submitted, and returns false if they may become available. It must be called
+// with s.mu held.
+func (s *Scheduler) unsatisfiable(t *task.Task) bool {
+	err := s.resourceMgr.Satisfiable(requests(t))
+	if err == nil {
+		return false
+	}
+	_ = t.Abandon(task.Canceled, fmt.Errorf("task %q: %w", t.ID(), err))
+	return true
+}
+
+// release frees the resources held by t, if any. It must be called without s.mu held,
+// because releasing resources unparks tasks that were waiting for them.
+func (s *Scheduler) release(t *task.Task) {
+	s.mu.Lock()
+	requests, holding := s.held[t]
+	delete(s.held, t)
+	s.mu.Unlock()
+
+	if holding {
+		_ = s.resourceMgr.ReleaseAll(requests)
+	}
+}
+
+// park sets aside a task whose resources are not available, so that it waits without holding a worker.
+// It must be called with s.mu held.
+func (s *Scheduler) park(t *task.Task) {
+	s.parked = append(s.parked, t)
+}
+
+// unpark returns the parked tasks to the queue when resources may have become available.
+func (s *Scheduler) unpark() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.parked {
+		s.queue.Push(t)
+	}
+	s.parked = nil
+	s.wake.Broadcast()
+}
+
+// isParked returns true if t is waiting for resources. It must be called with s.mu held.
+func (s *Scheduler) isParked(t *task.Task) bool {
+	for _, parked := range s.parked {
+		if parked == t {
+			return true
+		}
+	}
+	return false
+}
+
+// unparkTask removes t from the parked tasks, and returns false if it was not parked. It must be called with s.mu held.
+func (s *Scheduler) unparkTask(t *task.Task) bool {
+	for i, parked := range s.parked {
+		if parked == t {
+			s.parked = append(s.parked[:i:i], s.parked[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
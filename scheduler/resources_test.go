@@ -0,0 +1,165 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/executor"
+	"github.com/CSXL/go-agent/resource"
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerResources(t *testing.T) {
+	newResourceScheduler := func(t *testing.T, workers int) (*scheduler.Scheduler, *resource.Manager) {
+		rm := resource.NewManager()
+		assert.NoError(t, rm.Register("gpu", resource.NewSemaphore(2)))
+		assert.NoError(t, rm.Register("db", resource.NewSemaphore(1)))
+		sch := scheduler.NewScheduler(executor.NewExecutor(workers), rm)
+		sch.Start()
+		t.Cleanup(sch.Stop)
+		return sch, rm
+	}
+
+	t.Run("exclusive", func(t *testing.T) {
+		sch, _ := newResourceScheduler(t, 3)
+
+		var using, maxUsing int32
+		var tasks []*task.Task
+		for _, id := range []string{"a", "b", "c"} {
+			tsk := task.NewTask(id, func(ctx context.Context) error {
+				n := atomic.AddInt32(&using, 1)
+				for {
+					max := atomic.LoadInt32(&maxUsing)
+					if n <= max || atomic.CompareAndSwapInt32(&maxUsing, max, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&using, -1)
+				return nil
+			}, task.LowPriority)
+			tsk.Require("db", 1)
+			assert.NoError(t, sch.Submit(tsk))
+			tasks = append(tasks, tsk)
+		}
+
+		// Tasks waiting for the database do not hold workers.
+		free := task.NewTask("free", func(ctx context.Context) error { return nil }, task.LowPriority)
+		assert.NoError(t, sch.Submit(free))
+		assert.NoError(t, free.Wait(context.Background()))
+		assert.False(t, tasks[2].State().IsTerminal())
+
+		for _, tsk := range tasks {
+			assert.NoError(t, tsk.Wait(context.Background()))
+			assert.Equal(t, task.Succeeded, tsk.State())
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&maxUsing))
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		sch, rm := newResourceScheduler(t, 2)
+		assert.NoError(t, rm.Allocate("db"))
+
+		tsk := task.NewTask("both", func(ctx context.Context) error { return nil }, task.LowPriority)
+		tsk.Require("gpu", 2)
+		tsk.Require("db", 1)
+		assert.NoError(t, sch.Submit(tsk))
+
+		// While the task waits for the database, it holds none of the GPUs.
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, task.Ready, tsk.State())
+		assert.NoError(t, rm.AcquireAll([]resource.Request{{Name: "gpu", Units: 2}}))
+		assert.NoError(t, rm.ReleaseAll([]resource.Request{{Name: "gpu", Units: 2}}))
+
+		assert.NoError(t, rm.Deallocate("db"))
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, tsk.State())
+	})
+
+	t.Run("released after failure and panic", func(t *testing.T) {
+		sch, rm := newResourceScheduler(t, 2)
+
+		failing := task.NewTask("failing", func(ctx context.Context) error {
+			return errors.New("failed")
+		}, task.LowPriority)
+		failing.Require("db", 1)
+		panicking := task.NewTask("panicking", func(ctx context.Context) error {
+			panic("boom")
+		}, task.LowPriority)
+		panicking.Require("db", 1)
+		assert.NoError(t, sch.SubmitGraph(failing, panicking))
+
+		assert.NoError(t, failing.Wait(context.Background()))
+		assert.NoError(t, panicking.Wait(context.Background()))
+		assert.Equal(t, task.Failed, failing.State())
+		assert.Equal(t, task.Failed, panicking.State())
+
+		// The executor reports completion after the task finishes, so wait for the release.
+		assert.Eventually(t, func() bool {
+			if err := rm.Allocate("db"); err != nil {
+				return false
+			}
+			return rm.Deallocate("db") == nil
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("unknown resource", func(t *testing.T) {
+		sch, _ := newResourceScheduler(t, 1)
+
+		tsk := task.NewTask("unknown", func(ctx context.Context) error { return nil }, task.LowPriority)
+		tsk.Require("tpu", 1)
+		assert.ErrorIs(t, sch.Submit(tsk), resource.ErrResourceNotFound)
+	})
+
+	t.Run("exceeds capacity", func(t *testing.T) {
+		sch, _ := newResourceScheduler(t, 1)
+
+		tsk := task.NewTask("greedy", func(ctx context.Context) error { return nil }, task.LowPriority)
+		tsk.Require("gpu", 3)
+		assert.ErrorIs(t, sch.Submit(tsk), resource.ErrExceedsCapacity)
+
+		split := task.NewTask("split", func(ctx context.Context) error { return nil }, task.LowPriority)
+		split.Require("gpu", 2)
+		split.Require("gpu", 1)
+		assert.ErrorIs(t, sch.Submit(split), resource.ErrExceedsCapacity)
+	})
+
+	t.Run("unregistered while waiting", func(t *testing.T) {
+		sch, rm := newResourceScheduler(t, 1)
+		assert.NoError(t, rm.Allocate("db"))
+
+		tsk := task.NewTask("waiting", func(ctx context.Context) error { return nil }, task.LowPriority)
+		tsk.Require("db", 1)
+		assert.NoError(t, sch.Submit(tsk))
+		time.Sleep(20 * time.Millisecond)
+
+		// A task that can never acquire its resources is resolved instead of waiting forever.
+		assert.NoError(t, rm.Unregister("db"))
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.Equal(t, task.Canceled, tsk.State())
+		assert.ErrorIs(t, tsk.Err(), resource.ErrResourceNotFound)
+		assert.Equal(t, 0, tsk.Attempts())
+	})
+
+	t.Run("cancel while waiting", func(t *testing.T) {
+		sch, rm := newResourceScheduler(t, 1)
+		assert.NoError(t, rm.Allocate("db"))
+
+		tsk := task.NewTask("waiting", func(ctx context.Context) error { return nil }, task.LowPriority)
+		tsk.Require("db", 1)
+		assert.NoError(t, sch.Submit(tsk))
+		time.Sleep(20 * time.Millisecond)
+
+		assert.NoError(t, sch.UpdatePriority("waiting", task.HighPriority))
+		assert.NoError(t, sch.Cancel("waiting", scheduler.ErrCanceled))
+		assert.NoError(t, rm.Deallocate("db"))
+		assert.Equal(t, task.Canceled, tsk.State())
+		assert.Equal(t, 0, tsk.Attempts())
+	})
+}
@@ -0,0 +1,62 @@
+package scheduler
+
+import "github.com/CSXL/go-agent/task"
+
+// DefaultRetention is the number of completed tasks a scheduler keeps for lookup by ID unless SetRetention is called.
+const DefaultRetention = 1000
+
+// SetRetention sets how many of the most recently completed tasks can still be looked up by ID, e.g. through Task,
+// after they complete. Unfinished tasks can always be looked up. Values below zero are treated as zero.
+func (s *Scheduler) SetRetention(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = n
+	s.evict()
+}
+
+// track records t as submitted until it completes. It must be called with s.mu held.
+func (s *Scheduler) track(t *task.Task) {
+	s.tasks[t.ID()] = t
+	s.submitted[t] = struct{}{}
+	t.Watch(func(tr task.Transition) {
+		if tr.To.IsTerminal() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.retire(t)
+		}
+	})
+	// The task may have completed before the watcher was registered.
+	if t.State().IsTerminal() {
+		s.retire(t)
+	}
+}
+
+// retire removes a completed task from the submitted tasks, keeping it available for lookup by ID
+// until it is one of more than the retention limit of completed tasks. It must be called with s.mu held.
+func (s *Scheduler) retire(t *task.Task) {
+	if _, submitted := s.submitted[t]; !submitted {
+		return
+	}
+	delete(s.submitted, t)
+	if s.tasks[t.ID()] != t {
+		// A later task with the same ID has replaced it.
+		return
+	}
+	s.finished = append(s.finished, t)
+	s.evict()
+}
+
+// evict removes the oldest completed tasks beyond the retention limit. It must be called with s.mu held.
+func (s *Scheduler) evict() {
+	for len(s.finished) > s.retention {
+		t := s.finished[0]
+		s.finished[0] = nil
+		s.finished = s.finished[1:]
+		if s.tasks[t.ID()] == t {
+			delete(s.tasks, t.ID())
+		}
+	}
+}
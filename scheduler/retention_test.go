@@ -0,0 +1,97 @@
+package scheduler_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestSchedulerRetention(t *testing.T) {
+	retention := func(n int) func(*scheduler.Scheduler) {
+		return func(sch *scheduler.Scheduler) { sch.SetRetention(n) }
+	}
+
+	// forgotten reports whether the scheduler no longer knows the task with the given ID.
+	forgotten := func(sch *scheduler.Scheduler, id string) func() bool {
+		return func() bool {
+			_, err := sch.Task(id)
+			return err == scheduler.ErrTaskNotFound
+		}
+	}
+
+	t.Run("keeps the most recently completed tasks", func(t *testing.T) {
+		sch := newScheduler(t, 1, retention(2))
+
+		for i := 1; i <= 3; i++ {
+			tsk := task.NewTask(fmt.Sprintf("task-%d", i), func(ctx context.Context) error { return nil }, task.LowPriority)
+			assert.NoError(t, sch.Submit(tsk))
+			assert.NoError(t, tsk.Wait(context.Background()))
+		}
+
+		assert.Eventually(t, forgotten(sch, "task-1"), time.Second, time.Millisecond)
+		for _, id := range []string{"task-2", "task-3"} {
+			tsk, err := sch.Task(id)
+			if assert.NoError(t, err) {
+				assert.Equal(t, task.Succeeded, tsk.State())
+			}
+		}
+	})
+
+	t.Run("keeps unfinished tasks", func(t *testing.T) {
+		sch := newScheduler(t, 1, retention(0))
+
+		release := make(chan struct{})
+		defer close(release)
+		running := task.NewTask("running", func(ctx context.Context) error {
+			<-release
+			return nil
+		}, task.LowPriority)
+		queued := task.NewTask("queued", func(ctx context.Context) error { return nil }, task.LowPriority)
+		assert.NoError(t, sch.Submit(running))
+		assert.NoError(t, sch.Submit(queued))
+		blocked := task.NewTask("blocked", func(ctx context.Context) error { return nil }, task.LowPriority)
+		blocked.AddDependency(running)
+		assert.NoError(t, sch.Submit(blocked))
+
+		assert.NoError(t, sch.Cancel("queued", nil))
+		assert.Eventually(t, forgotten(sch, "queued"), time.Second, time.Millisecond)
+		for _, id := range []string{"running", "blocked"} {
+			_, err := sch.Task(id)
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("depends on forgotten tasks", func(t *testing.T) {
+		sch := newScheduler(t, 1, retention(0))
+
+		dep := task.NewTask("dep", func(ctx context.Context) error { return nil }, task.LowPriority)
+		assert.NoError(t, sch.Submit(dep))
+		assert.NoError(t, dep.Wait(context.Background()))
+		assert.Eventually(t, forgotten(sch, "dep"), time.Second, time.Millisecond)
+
+		tsk := task.NewTask("task", func(ctx context.Context) error { return nil }, task.LowPriority)
+		tsk.AddDependency(dep)
+		assert.NoError(t, sch.Submit(tsk))
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, tsk.State())
+	})
+
+	t.Run("lowering the limit forgets completed tasks", func(t *testing.T) {
+		sch := newScheduler(t, 1, retention(scheduler.DefaultRetention))
+
+		tsk := task.NewTask("task", func(ctx context.Context) error { return nil }, task.LowPriority)
+		assert.NoError(t, sch.Submit(tsk))
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.Eventually(t, func() bool {
+			// The task is retired asynchronously after it completes.
+			sch.SetRetention(0)
+			return forgotten(sch, "task")()
+		}, time.Second, time.Millisecond)
+	})
+}
@@ -1,75 +1,532 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/CSXL/go-agent/clock"
 	"github.com/CSXL/go-agent/executor"
 	"github.com/CSXL/go-agent/resource"
 	"github.com/CSXL/go-agent/task"
 )
 
+var (
+	// ErrTaskNotFound is returned when a task ID does not match any submitted task.
+	ErrTaskNotFound = errors.New("task not found")
+
+	// ErrTaskFinished is returned when an operation requires a task that has not yet finished.
+	ErrTaskFinished = errors.New("task already finished")
+
+	// ErrTaskRunning is returned when an operation requires a task that has not yet been dispatched.
+	ErrTaskRunning = errors.New("task already running")
+
+	// ErrCanceled is the cause recorded for tasks canceled through the scheduler.
+	ErrCanceled = errors.New("task canceled")
+
+	// ErrStopped is returned when a task is submitted to a scheduler that is shutting down or has stopped.
+	ErrStopped = errors.New("scheduler stopped")
+
+	// ErrShutdown is the cause recorded for tasks canceled because they had not completed when the scheduler shut down.
+	ErrShutdown = errors.New("scheduler shut down")
+)
+
 // Scheduler is responsible for managing and scheduling tasks for execution.
+// Queued tasks are held in a priority queue per group and handed to the executor by a
+// dispatcher goroutine, one at a time, whenever a worker is free. Tasks with higher priorities
+// are dispatched first, and groups with tasks of the same priority share workers by weight.
 type Scheduler struct {
-	mu          sync.Mutex
-	executor    *executor.Executor
-	resourceMgr *resource.Manager
-	priorityMap map[task.Priority][]*task.Task
+	mu                sync.Mutex
+	wake              *sync.Cond
+	executor          *executor.Executor
+	resourceMgr       *resource.Manager
+	queue             *fairQueue
+	tasks             map[string]*task.Task
+	submitted         map[*task.Task]struct{}
+	finished          []*task.Task
+	blocked           map[*task.Task]map[*task.Task]func()
+	clock             clock.Clock
+	delayed           map[*task.Task]*delayedTask
+	timers            delayHeap
+	timer             clock.Timer
+	armedAt           time.Time
+	throttle          clock.Timer
+	autoscaler        *autoscaler
+	jobs              map[string]*job
+	idempotent        map[string]*idempotent
+	held              map[*task.Task][]resource.Request
+	parked            []*task.Task
+	active            map[*task.Task]struct{}
+	preempting        *task.Task
+	running           int
+	capacity          int
+	retention         int
+	overflow          OverflowPolicy
+	idempotencyWindow time.Duration
+	maxPreemptions    int
+	draining          bool
+	stopped           bool
+	dispatching       chan struct{}
+
+	subscribers    []subscriber
+	nextSubscriber int
 }
 
 // NewScheduler creates a new Scheduler with the given executor and resource manager.
 func NewScheduler(executor *executor.Executor, resourceMgr *resource.Manager) *Scheduler {
-	return &Scheduler{
+	s := &Scheduler{
 		executor:    executor,
 		resourceMgr: resourceMgr,
-		priorityMap: make(map[task.Priority][]*task.Task),
+		queue:       newFairQueue(),
+		tasks:       make(map[string]*task.Task),
+		submitted:   make(map[*task.Task]struct{}),
+		blocked:     make(map[*task.Task]map[*task.Task]func()),
+		clock:       clock.Real(),
+		delayed:     make(map[*task.Task]*delayedTask),
+		jobs:        make(map[string]*job),
+		idempotent:  make(map[string]*idempotent),
+		held:        make(map[*task.Task][]resource.Request),
+		active:      make(map[*task.Task]struct{}),
+		retention:   DefaultRetention,
 	}
+	s.wake = sync.NewCond(&s.mu)
+	executor.OnComplete(s.complete)
+	resourceMgr.OnRelease(s.unpark)
+	return s
 }
 
-// Start initializes the scheduler and starts the executor.
+// Start initializes the scheduler and starts the executor and the dispatcher.
 func (s *Scheduler) Start() {
 	s.executor.Start()
+	s.dispatching = make(chan struct{})
+	go s.dispatch()
 }
 
-// Stop gracefully shuts down the scheduler and its executor.
+// Stop shuts down the scheduler and its executor. Tasks that have not completed, including running tasks,
+// are canceled with ErrStopped as the cause. Stopping a scheduler that has already stopped has no effect.
 func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	s.stopJobs()
+	abandoned := s.abandon()
+	s.delayed = make(map[*task.Task]*delayedTask)
+	s.timers = nil
+	s.arm()
+	if s.throttle != nil {
+		s.throttle.Stop()
+		s.throttle = nil
+	}
+	if s.autoscaler != nil {
+		s.autoscaler.timer.Stop()
+		s.autoscaler = nil
+	}
+	s.mu.Unlock()
+
+	for _, t := range abandoned {
+		t.CancelWithCause(ErrStopped)
+	}
+	s.stopDispatcher()
 	s.executor.Stop()
 }
 
 // SoftStop gracefully shuts down the scheduler and its executor after all tasks have completed.
+// Recurring jobs are not run again, but runs that have already been submitted complete.
 func (s *Scheduler) SoftStop() {
-	// Wait for the priorty map to be empty.
+	_, _ = s.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting tasks and waits until every submitted task has completed, including any retries,
+// or ctx is done, and then stops the scheduler and its executor. Recurring jobs are not run again. Tasks that
+// have not completed when ctx is done are canceled with ErrShutdown as the cause, and are returned along with
+// the context's error.
+func (s *Scheduler) Shutdown(ctx context.Context) ([]*task.Task, error) {
+	s.mu.Lock()
+	s.draining = true
+	s.stopJobs()
+	stopWatching := s.wakeOnDone(ctx)
+	for !s.idle() && ctx.Err() == nil {
+		s.wake.Wait()
+	}
+	stopWatching()
+
+	var abandoned []*task.Task
+	var err error
+	if !s.idle() {
+		err = ctx.Err()
+		abandoned = s.abandon()
+	}
+	s.mu.Unlock()
+
+	for _, t := range abandoned {
+		t.CancelWithCause(ErrShutdown)
+	}
+	s.Stop()
+	return abandoned, err
+}
+
+// abandon removes every submitted task that has not completed from the scheduler, and returns them in the
+// order they were submitted, to be canceled. It must be called with s.mu held.
+func (s *Scheduler) abandon() []*task.Task {
+	var abandoned []*task.Task
+	for t := range s.submitted {
+		if !t.State().IsTerminal() {
+			s.remove(t)
+			delete(s.submitted, t)
+			abandoned = append(abandoned, t)
+		}
+	}
+	sort.Slice(abandoned, func(i, j int) bool {
+		si, sj := abandoned[i].SubmittedAt(), abandoned[j].SubmittedAt()
+		if !si.Equal(sj) {
+			return si.Before(sj)
+		}
+		return abandoned[i].ID() < abandoned[j].ID()
+	})
+	return abandoned
+}
+
+// idle returns true if no submitted task is waiting or running. It must be called with s.mu held.
+func (s *Scheduler) idle() bool {
+	return s.queue.Len() == 0 &&
+		len(s.blocked) == 0 &&
+		len(s.delayed) == 0 &&
+		len(s.parked) == 0 &&
+		s.running == 0
+}
+
+// stopDispatcher stops the dispatcher and waits for it to exit.
+func (s *Scheduler) stopDispatcher() {
+	s.mu.Lock()
+	s.stopped = true
+	s.wake.Broadcast()
+	s.mu.Unlock()
+	if s.dispatching != nil {
+		<-s.dispatching
+	}
+}
+
+// dispatch hands the highest-priority queued task to the executor each time a worker is free,
+// until the scheduler is stopped.
+func (s *Scheduler) dispatch() {
+	defer close(s.dispatching)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	for {
+		for !s.stopped && (s.queue.Len() == 0 || s.running >= s.executor.WorkerCount()) {
+			if victim := s.victim(); victim != nil {
+				s.preempt(victim)
+				continue
+			}
+			s.wake.Wait()
+		}
+		if s.stopped {
+			return
+		}
+
+		t := s.queue.Pop(s.clock.Now())
+		if t == nil {
+			// Every queued task belongs to a group held back by its rate limit.
+			s.armThrottle()
+			s.wake.Wait()
+			continue
+		}
+		// Submissions waiting for room in the queue may now proceed.
+		s.wake.Broadcast()
+		// Tasks canceled while queued are no longer ready and are dropped.
+		if t.State() != task.Ready {
+			continue
+		}
+		if !s.acquire(t) {
+			if !s.unsatisfiable(t) {
+				s.park(t)
+			}
+			continue
+		}
+		s.queue.Dispatched(t.Group(), s.clock.Now())
+		s.active[t] = struct{}{}
+		s.running++
+		s.noteIdle()
+
+		// A worker is free, so this only waits for it to receive the task.
+		s.mu.Unlock()
+		s.executor.Submit(t)
 		s.mu.Lock()
-		empty := len(s.priorityMap[task.HighPriority]) == 0 &&
-			len(s.priorityMap[task.MediumPriority]) == 0 &&
-			len(s.priorityMap[task.LowPriority]) == 0
+	}
+}
+
+// Submit adds a task to the scheduler's task queue. A task with dependencies is held
+// until all of them have completed, and is queued for execution as soon as they have.
+// It returns an error if the task has already been submitted, depends on a task that
+// has not been submitted, or its dependencies form a cycle. If the queue is full, the task
+// is handled according to the scheduler's overflow policy; see SetQueueLimit.
+func (s *Scheduler) Submit(t *task.Task) error {
+	return s.SubmitGraph(t)
+}
+
+// SubmitGraph validates and submits a set of tasks atomically: either all of them are submitted,
+// or none are and an error is returned. Tasks may depend on each other or on previously submitted tasks.
+func (s *Scheduler) SubmitGraph(tasks ...*task.Task) error {
+	return s.submit(context.Background(), false, tasks, time.Time{})
+}
+
+// Task returns the most recently submitted task with the given ID. Completed tasks can only be looked up
+// while they are among the most recently completed ones; see SetRetention.
+func (s *Scheduler) Task(id string) (*task.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, exists := s.tasks[id]
+	if !exists {
+		return nil, ErrTaskNotFound
+	}
+	return t, nil
+}
+
+// Cancel cancels the most recently submitted task with the given ID, recording cause as the reason.
+// A queued task is removed from the scheduler and never runs, and a running task has its context canceled.
+func (s *Scheduler) Cancel(id string, cause error) error {
+	s.mu.Lock()
+	t, exists := s.tasks[id]
+	if !exists {
 		s.mu.Unlock()
+		return ErrTaskNotFound
+	}
+	if t.State().IsTerminal() {
+		s.mu.Unlock()
+		return ErrTaskFinished
+	}
+	s.remove(t)
+	s.mu.Unlock()
 
-		if empty {
-			break
-		}
+	t.CancelWithCause(cause)
+	return nil
+}
+
+// UpdatePriority changes the priority of the most recently submitted task with the given ID,
+// moving it to its new place in the queue if it is queued, and emits a PriorityChanged event.
+// It returns ErrTaskRunning if the task has already been dispatched, and ErrTaskFinished if it has finished.
+func (s *Scheduler) UpdatePriority(id string, priority task.Priority) error {
+	s.mu.Lock()
+	t, exists := s.tasks[id]
+	if !exists {
+		s.mu.Unlock()
+		return ErrTaskNotFound
 	}
-	s.executor.SoftStop()
+	state := t.State()
+	if state.IsTerminal() {
+		s.mu.Unlock()
+		return ErrTaskFinished
+	}
+	// Ready tasks that are neither queued nor waiting for resources have been handed to the executor.
+	if state == task.Running || (state == task.Ready && !s.queue.Contains(t) && !s.isParked(t)) {
+		s.mu.Unlock()
+		return ErrTaskRunning
+	}
+
+	old := t.Priority()
+	if !s.queue.UpdatePriority(t, priority) {
+		// Held and retrying tasks are queued with their current priority once they are ready.
+		t.SetPriority(priority)
+	}
+	subscribers := s.subscribers
+	s.mu.Unlock()
+
+	emit(subscribers, Event{
+		Type:        PriorityChanged,
+		TaskID:      id,
+		OldPriority: old,
+		NewPriority: priority,
+		At:          time.Now(),
+	})
+	return nil
 }
 
-// Submit adds a task to the scheduler's task queue.
-func (s *Scheduler) Submit(t *task.Task) {
+// SetAging raises the effective priority of queued tasks by one for every interval they have waited,
+// so that a steady stream of higher-priority tasks cannot starve lower-priority ones indefinitely.
+// An interval of zero or less disables aging. It has no effect under policies that do not order by priority.
+func (s *Scheduler) SetAging(interval time.Duration) {
+	s.queue.SetAging(interval)
+}
+
+// EffectivePriority returns the priority the most recently submitted task with the given ID is currently
+// ordered by. For a queued task this includes any aging; for other tasks it is the task's priority.
+func (s *Scheduler) EffectivePriority(id string) (task.Priority, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.priorityMap[t.Priority()] = append(s.priorityMap[t.Priority()], t)
-	s.scheduleTasks()
+	t, exists := s.tasks[id]
+	if !exists {
+		return 0, ErrTaskNotFound
+	}
+	if priority, queued := s.queue.EffectivePriority(t); queued {
+		return priority, nil
+	}
+	return t.Priority(), nil
+}
+
+// CancelWhere cancels every unfinished task for which match returns true, recording cause as the reason,
+// and returns the canceled tasks.
+func (s *Scheduler) CancelWhere(match func(*task.Task) bool, cause error) []*task.Task {
+	s.mu.Lock()
+	var canceled []*task.Task
+	for t := range s.submitted {
+		if !t.State().IsTerminal() && match(t) {
+			s.remove(t)
+			canceled = append(canceled, t)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, t := range canceled {
+		t.CancelWithCause(cause)
+	}
+	return canceled
+}
+
+// remove deletes a task that has not started from the scheduler's queues. It must be called with s.mu held.
+func (s *Scheduler) remove(t *task.Task) {
+	s.queue.Remove(t)
+	s.unparkTask(t)
+	s.unblock(t)
+	s.wake.Broadcast()
+	s.undelay(t)
+}
+
+// complete is called by the executor when a task finishes executing. It frees the task's worker
+// for the dispatcher, and resubmits the task after its backoff if the attempt failed and will be retried.
+func (s *Scheduler) complete(t *task.Task, _ error) {
+	s.release(t)
+
+	s.mu.Lock()
+	delete(s.active, t)
+	if s.preempting == t {
+		s.preempting = nil
+	}
+	s.running--
+	s.noteIdle()
+	s.wake.Broadcast()
+	s.scheduleRetry(t)
+	stopped := s.stopped
+	s.mu.Unlock()
+
+	// A task that would have run again, e.g. because it was preempted, is not once the scheduler has stopped.
+	if stopped && !t.State().IsTerminal() {
+		t.CancelWithCause(ErrStopped)
+	}
 }
 
-// scheduleTasks schedules tasks from the priority map for execution.
-func (s *Scheduler) scheduleTasks() {
-	for _, priority := range []task.Priority{task.HighPriority, task.MediumPriority, task.LowPriority} {
-		taskList := s.priorityMap[priority]
-		for len(taskList) > 0 {
-			t := taskList[0]
-			taskList = taskList[1:]
-			s.priorityMap[priority] = taskList
+// scheduleRetry resubmits t after its backoff if its last attempt failed and will be retried.
+// It must be called with s.mu held.
+func (s *Scheduler) scheduleRetry(t *task.Task) {
+	delay, retry := t.PendingRetry()
+	if !retry || s.stopped {
+		return
+	}
+	s.delay(t, s.clock.Now().Add(delay))
+}
 
-			s.executor.Submit(t)
+// holdForDependencies blocks t until all of its dependencies have completed, and returns false if
+// they already have. If a dependency has already failed, t is resolved according to its failure policy.
+// It must be called with s.mu held.
+func (s *Scheduler) holdForDependencies(t *task.Task) bool {
+	outstanding := make(map[*task.Task]func())
+	for _, dep := range t.Dependencies() {
+		if !dep.State().IsTerminal() {
+			outstanding[dep] = nil
+			continue
+		}
+		if s.propagateFailure(t, dep) {
+			return true
 		}
 	}
+	if len(outstanding) == 0 {
+		return false
+	}
+
+	s.blocked[t] = outstanding
+	for dep := range outstanding {
+		dep := dep
+		outstanding[dep] = dep.Watch(func(tr task.Transition) {
+			if tr.To.IsTerminal() {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				s.dependencyDone(t, dep)
+			}
+		})
+	}
+	// Dependencies may have completed before their watchers were registered.
+	for dep := range outstanding {
+		if dep.State().IsTerminal() {
+			s.dependencyDone(t, dep)
+		}
+	}
+	return true
+}
+
+// dependencyDone records that dep has completed, and queues t for execution if it was the last
+// of t's outstanding dependencies. If dep did not succeed, t is resolved according to its failure policy.
+// It must be called with s.mu held.
+func (s *Scheduler) dependencyDone(t, dep *task.Task) {
+	outstanding, blocked := s.blocked[t]
+	if !blocked {
+		return
+	}
+	if unwatch, ok := outstanding[dep]; ok {
+		unwatch()
+		delete(outstanding, dep)
+	}
+	if s.propagateFailure(t, dep) {
+		s.unblock(t)
+		s.wake.Broadcast()
+		return
+	}
+	if len(outstanding) > 0 {
+		return
+	}
+	delete(s.blocked, t)
+	s.enqueue(t)
+}
+
+// unblock stops t from waiting for its outstanding dependencies. It must be called with s.mu held.
+func (s *Scheduler) unblock(t *task.Task) {
+	for _, unwatch := range s.blocked[t] {
+		unwatch()
+	}
+	delete(s.blocked, t)
+}
+
+// propagateFailure resolves t without running it if dep did not succeed and t's failure policy for dep
+// does not allow it to run anyway, and reports whether it did so. Because t itself then does not succeed,
+// the failure propagates transitively to its own dependents.
+func (s *Scheduler) propagateFailure(t, dep *task.Task) bool {
+	state := dep.State()
+	if state == task.Succeeded {
+		return false
+	}
+
+	resolved := task.Skipped
+	switch t.DependencyPolicy(dep) {
+	case task.RunOnFailure:
+		return false
+	case task.CancelOnFailure:
+		resolved = task.Canceled
+	}
+	_ = t.Abandon(resolved, &task.UpstreamError{TaskID: dep.ID(), State: state, Err: dep.Err()})
+	return true
+}
+
+// enqueue marks t as ready and adds it to the queue. It must be called with s.mu held.
+func (s *Scheduler) enqueue(t *task.Task) {
+	// Waiters are woken even if t was canceled, since it is no longer held anywhere else.
+	defer s.wake.Broadcast()
+	if err := t.MarkReady(); err != nil {
+		return
+	}
+	s.queue.Push(t)
 }
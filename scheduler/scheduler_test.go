@@ -2,23 +2,21 @@ package scheduler_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/CSXL/go-agent/executor"
-	"github.com/CSXL/go-agent/resource"
 	"github.com/CSXL/go-agent/scheduler"
 	"github.com/CSXL/go-agent/task"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestScheduler(t *testing.T) {
 	t.Run("submit", func(t *testing.T) {
-		ex := executor.NewExecutor(4)
-		rm := resource.NewManager()
-		sch := scheduler.NewScheduler(ex, rm)
-		sch.Start()
-		defer sch.Stop()
+		sch := newScheduler(t, 4)
 
 		var wg sync.WaitGroup
 		for i := 0; i < 10; i++ {
@@ -35,10 +33,7 @@ func TestScheduler(t *testing.T) {
 	})
 
 	t.Run("softstop", func(t *testing.T) {
-		ex := executor.NewExecutor(4)
-		rm := resource.NewManager()
-		sch := scheduler.NewScheduler(ex, rm)
-		sch.Start()
+		sch := newScheduler(t, 4)
 
 		for i := 0; i < 10; i++ {
 			tsk := task.NewTask("test_task", func(ctx context.Context) error {
@@ -49,4 +44,429 @@ func TestScheduler(t *testing.T) {
 		}
 		sch.SoftStop()
 	})
+	t.Run("task lookup", func(t *testing.T) {
+		sch := newScheduler(t, 4)
+
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		sch.Submit(tsk)
+
+		found, err := sch.Task("test_task")
+		assert.NoError(t, err)
+		assert.Equal(t, tsk, found)
+
+		_, err = sch.Task("missing")
+		assert.True(t, errors.Is(err, scheduler.ErrTaskNotFound))
+	})
+	t.Run("retry", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			if task.Attempt(ctx) < 3 {
+				return errors.New("transient")
+			}
+			return nil
+		}, task.LowPriority)
+		tsk.SetRetryPolicy(task.RetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Millisecond})
+		sch.Submit(tsk)
+
+		err := tsk.Wait(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, tsk.Err())
+		assert.Equal(t, 3, tsk.Attempts())
+		assert.Equal(t, task.Succeeded, tsk.State())
+	})
+	t.Run("expire before start", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		blocker := task.NewTask("blocker", func(ctx context.Context) error {
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		}, task.LowPriority)
+		sch.Submit(blocker)
+
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		tsk.SetTimeout(50 * time.Millisecond)
+		tsk.SetExpireBeforeStart(true)
+		go sch.Submit(tsk)
+
+		time.Sleep(10 * time.Millisecond)
+		err := tsk.Wait(context.Background())
+		assert.NoError(t, err)
+		assert.ErrorIs(t, tsk.Err(), task.ErrTimeout)
+		assert.Equal(t, 0, tsk.Attempts())
+	})
+	t.Run("dependencies", func(t *testing.T) {
+		sch := newScheduler(t, 4)
+
+		var mu sync.Mutex
+		var order []string
+		newTask := func(id string) *task.Task {
+			return task.NewTask(id, func(ctx context.Context) error {
+				time.Sleep(50 * time.Millisecond)
+				mu.Lock()
+				order = append(order, id)
+				mu.Unlock()
+				return nil
+			}, task.LowPriority)
+		}
+
+		extract := newTask("extract")
+		transform := newTask("transform")
+		load := newTask("load")
+		transform.AddDependency(extract)
+		load.AddDependency(transform)
+		load.AddDependency(extract)
+
+		sch.Submit(extract)
+		sch.Submit(transform)
+		sch.Submit(load)
+		assert.Equal(t, task.Pending, load.State())
+
+		err := load.Wait(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"extract", "transform", "load"}, order)
+	})
+
+	t.Run("completed dependency", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		dep := task.NewTask("dep", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		sch.Submit(dep)
+		assert.NoError(t, dep.Wait(context.Background()))
+
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		tsk.AddDependency(dep)
+		sch.Submit(tsk)
+
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, tsk.State())
+	})
+	t.Run("failure propagation", func(t *testing.T) {
+		sch := newScheduler(t, 2)
+
+		cause := errors.New("extract failed")
+		extract := task.NewTask("extract", func(ctx context.Context) error {
+			time.Sleep(50 * time.Millisecond)
+			return cause
+		}, task.LowPriority)
+
+		ran := make(chan string, 3)
+		newTask := func(id string) *task.Task {
+			return task.NewTask(id, func(ctx context.Context) error {
+				ran <- id
+				return nil
+			}, task.LowPriority)
+		}
+		transform := newTask("transform")
+		transform.AddDependency(extract)
+		load := newTask("load")
+		load.SetFailurePolicy(task.CancelOnFailure)
+		load.AddDependency(transform)
+		cleanup := newTask("cleanup")
+		cleanup.AddDependencyWithPolicy(load, task.RunOnFailure)
+
+		err := sch.SubmitGraph(extract, transform, load, cleanup)
+		assert.NoError(t, err)
+		assert.NoError(t, cleanup.Wait(context.Background()))
+
+		assert.Equal(t, task.Failed, extract.State())
+		assert.Equal(t, task.Skipped, transform.State())
+		assert.Equal(t, task.Canceled, load.State())
+		assert.Equal(t, task.Succeeded, cleanup.State())
+		assert.Equal(t, "cleanup", <-ran)
+
+		var upstream *task.UpstreamError
+		assert.ErrorAs(t, load.Err(), &upstream)
+		assert.Equal(t, "transform", upstream.TaskID)
+		assert.Equal(t, task.Skipped, upstream.State)
+		assert.ErrorIs(t, load.Err(), cause)
+	})
+
+	t.Run("already failed dependency", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		dep := task.NewTask("dep", func(ctx context.Context) error {
+			return errors.New("dep failed")
+		}, task.LowPriority)
+		assert.NoError(t, sch.Submit(dep))
+		assert.NoError(t, dep.Wait(context.Background()))
+
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		tsk.AddDependency(dep)
+		assert.NoError(t, sch.Submit(tsk))
+
+		assert.Equal(t, task.Skipped, tsk.State())
+		assert.Equal(t, 0, tsk.Attempts())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		running := task.NewTask("running", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, task.LowPriority)
+		assert.NoError(t, sch.Submit(running))
+
+		called := false
+		blocked := task.NewTask("blocked", func(ctx context.Context) error {
+			called = true
+			return nil
+		}, task.LowPriority)
+		blocked.AddDependencyWithPolicy(running, task.RunOnFailure)
+		assert.NoError(t, sch.Submit(blocked))
+
+		assert.NoError(t, sch.Cancel("blocked", scheduler.ErrCanceled))
+		assert.NoError(t, blocked.Wait(context.Background()))
+		assert.Equal(t, task.Canceled, blocked.State())
+		assert.ErrorIs(t, blocked.Err(), scheduler.ErrCanceled)
+
+		assert.NoError(t, sch.Cancel("running", scheduler.ErrCanceled))
+		assert.NoError(t, running.Wait(context.Background()))
+		assert.Equal(t, task.Canceled, running.State())
+		assert.ErrorIs(t, running.Err(), scheduler.ErrCanceled)
+		assert.False(t, called)
+
+		assert.ErrorIs(t, sch.Cancel("running", nil), scheduler.ErrTaskFinished)
+		assert.ErrorIs(t, sch.Cancel("missing", nil), scheduler.ErrTaskNotFound)
+	})
+
+	t.Run("cancel where", func(t *testing.T) {
+		sch := newScheduler(t, 3)
+
+		var tasks []*task.Task
+		for _, id := range []string{"keep", "drop-1", "drop-2"} {
+			tsk := task.NewTask(id, func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}, task.LowPriority)
+			assert.NoError(t, sch.Submit(tsk))
+			tasks = append(tasks, tsk)
+		}
+
+		canceled := sch.CancelWhere(func(tsk *task.Task) bool {
+			return strings.HasPrefix(tsk.ID(), "drop")
+		}, scheduler.ErrCanceled)
+
+		assert.Len(t, canceled, 2)
+		for _, tsk := range tasks[1:] {
+			assert.NoError(t, tsk.Wait(context.Background()))
+			assert.Equal(t, task.Canceled, tsk.State())
+		}
+		assert.NotEqual(t, task.Canceled, tasks[0].State())
+		tasks[0].Cancel()
+	})
+	t.Run("priority", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		release := make(chan struct{})
+		blocker := task.NewTask("blocker", func(ctx context.Context) error {
+			<-release
+			return nil
+		}, task.LowPriority)
+		assert.NoError(t, sch.Submit(blocker))
+
+		started := make(chan string, 1002)
+		newTask := func(id string, priority task.Priority) *task.Task {
+			return task.NewTask(id, func(ctx context.Context) error {
+				started <- id
+				return nil
+			}, priority)
+		}
+		for i := 0; i < 1000; i++ {
+			assert.NoError(t, sch.Submit(newTask(fmt.Sprintf("low-%d", i), task.LowPriority)))
+		}
+		assert.NoError(t, sch.Submit(newTask("medium", task.MediumPriority)))
+		high := newTask("high", task.HighPriority)
+		assert.NoError(t, sch.Submit(high))
+
+		close(release)
+		assert.Equal(t, "high", <-started)
+		assert.Equal(t, "medium", <-started)
+		assert.Equal(t, "low-0", <-started)
+	})
+
+	t.Run("update priority", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		release := make(chan struct{})
+		running := make(chan struct{})
+		blocker := task.NewTask("blocker", func(ctx context.Context) error {
+			close(running)
+			<-release
+			return nil
+		}, task.LowPriority)
+		assert.NoError(t, sch.Submit(blocker))
+		<-running
+
+		started := make(chan string, 3)
+		for _, id := range []string{"first", "second", "third"} {
+			id := id
+			assert.NoError(t, sch.Submit(task.NewTask(id, func(ctx context.Context) error {
+				started <- id
+				return nil
+			}, task.LowPriority)))
+		}
+
+		assert.NoError(t, sch.UpdatePriority("third", task.HighPriority))
+		assert.ErrorIs(t, sch.UpdatePriority("blocker", task.HighPriority), scheduler.ErrTaskRunning)
+		assert.ErrorIs(t, sch.UpdatePriority("missing", task.HighPriority), scheduler.ErrTaskNotFound)
+
+		close(release)
+		assert.Equal(t, "third", <-started)
+		assert.Equal(t, "first", <-started)
+		assert.Equal(t, "second", <-started)
+		assert.ErrorIs(t, sch.UpdatePriority("blocker", task.HighPriority), scheduler.ErrTaskFinished)
+	})
+
+	t.Run("aging", func(t *testing.T) {
+		sch, c := newFakeScheduler(t, 1, func(sch *scheduler.Scheduler) { sch.SetAging(time.Second) })
+
+		release := make(chan struct{})
+		running := make(chan struct{})
+		blocker := task.NewTask("blocker", func(ctx context.Context) error {
+			close(running)
+			<-release
+			return nil
+		}, task.LowPriority)
+		assert.NoError(t, sch.Submit(blocker))
+		<-running
+
+		started := make(chan string, 2)
+		newTask := func(id string, priority task.Priority) *task.Task {
+			return task.NewTask(id, func(ctx context.Context) error {
+				started <- id
+				return nil
+			}, priority)
+		}
+		assert.NoError(t, sch.Submit(newTask("low", task.LowPriority)))
+		c.Advance(101 * time.Second)
+		assert.NoError(t, sch.Submit(newTask("high", task.HighPriority)))
+
+		priority, err := sch.EffectivePriority("low")
+		assert.NoError(t, err)
+		assert.Equal(t, task.LowPriority+101, priority)
+		priority, err = sch.EffectivePriority("blocker")
+		assert.NoError(t, err)
+		assert.Equal(t, task.LowPriority, priority)
+
+		close(release)
+		assert.Equal(t, "low", <-started)
+		assert.Equal(t, "high", <-started)
+	})
+
+	t.Run("submit from running task", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		inner := task.NewTask("inner", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		outer := task.NewTask("outer", func(ctx context.Context) error {
+			return sch.Submit(inner)
+		}, task.LowPriority)
+		assert.NoError(t, sch.Submit(outer))
+
+		assert.NoError(t, inner.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, outer.State())
+		assert.Equal(t, task.Succeeded, inner.State())
+	})
+}
+
+func TestSchedulerStop(t *testing.T) {
+	sch := newScheduler(t, 1)
+
+	started := make(chan struct{})
+	running := task.NewTask("running", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, task.LowPriority)
+	queued := task.NewTask("queued", func(ctx context.Context) error { return nil }, task.LowPriority)
+	blocked := task.NewTask("blocked", func(ctx context.Context) error { return nil }, task.LowPriority)
+	blocked.AddDependency(queued)
+	delayed := task.NewTask("delayed", func(ctx context.Context) error { return nil }, task.LowPriority)
+	assert.NoError(t, sch.Submit(running))
+	<-started
+	assert.NoError(t, sch.SubmitGraph(queued, blocked))
+	assert.NoError(t, sch.SubmitAfter(delayed, time.Hour))
+
+	sch.Stop()
+
+	// Every unfinished task is resolved, so waiting for it returns.
+	for _, tsk := range []*task.Task{running, queued, blocked, delayed} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		assert.NoError(t, tsk.Wait(ctx), tsk.ID())
+		cancel()
+		assert.True(t, tsk.State().IsTerminal(), tsk.ID())
+		assert.ErrorIs(t, tsk.Err(), scheduler.ErrStopped, tsk.ID())
+	}
+}
+
+func TestSchedulerShutdown(t *testing.T) {
+	t.Run("drains", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		var tasks []*task.Task
+		for i := 0; i < 3; i++ {
+			tsk := task.NewTask(fmt.Sprintf("task-%d", i), func(ctx context.Context) error {
+				if task.Attempt(ctx) == 1 {
+					return errors.New("transient")
+				}
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			}, task.LowPriority)
+			tsk.SetRetryPolicy(task.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+			assert.NoError(t, sch.Submit(tsk))
+			tasks = append(tasks, tsk)
+		}
+
+		abandoned, err := sch.Shutdown(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, abandoned)
+		for _, tsk := range tasks {
+			assert.Equal(t, task.Succeeded, tsk.State())
+		}
+
+		late := task.NewTask("late", func(ctx context.Context) error { return nil }, task.LowPriority)
+		assert.ErrorIs(t, sch.Submit(late), scheduler.ErrStopped)
+
+		// The scheduler has already stopped, so stopping it again has no effect.
+		sch.Stop()
+	})
+
+	t.Run("abandons the remainder", func(t *testing.T) {
+		sch := newScheduler(t, 1)
+
+		started := make(chan struct{})
+		running := task.NewTask("running", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}, task.LowPriority)
+		queued := task.NewTask("queued", func(ctx context.Context) error { return nil }, task.LowPriority)
+		assert.NoError(t, sch.Submit(running))
+		<-started
+		assert.NoError(t, sch.Submit(queued))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		abandoned, err := sch.Shutdown(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, []*task.Task{running, queued}, abandoned)
+		for _, tsk := range abandoned {
+			assert.NoError(t, tsk.Wait(context.Background()))
+			assert.Equal(t, task.Canceled, tsk.State())
+			assert.ErrorIs(t, tsk.Err(), scheduler.ErrShutdown)
+		}
+	})
 }
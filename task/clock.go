@@ -0,0 +1,25 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/CSXL/go-agent/clock"
+)
+
+// clockKey is the context key for the clock that tasks measure their queue expiry with.
+type clockKey struct{}
+
+// WithClock returns a context under which tasks check whether they have expired before starting against c
+// instead of the system time. Schedulers use it so that tasks agree with the clock they were submitted by.
+func WithClock(ctx context.Context, c clock.Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// clockNow returns the current time of the clock under the given context, or the system time if it has none.
+func clockNow(ctx context.Context) time.Time {
+	if c, ok := ctx.Value(clockKey{}).(clock.Clock); ok {
+		return c.Now()
+	}
+	return time.Now()
+}
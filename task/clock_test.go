@@ -0,0 +1,40 @@
+package task_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/clock"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestTaskWithClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newTask := func() *task.Task {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error { return nil }, task.LowPriority)
+		tsk.SetTimeout(time.Minute)
+		tsk.SetExpireBeforeStart(true)
+		assert.NoError(t, tsk.MarkSubmittedAt(start))
+		return tsk
+	}
+
+	t.Run("before expiry", func(t *testing.T) {
+		c := clock.NewFake(start.Add(59 * time.Second))
+		tsk := newTask()
+
+		assert.NoError(t, tsk.Execute(task.WithClock(context.Background(), c)))
+		assert.Equal(t, task.Succeeded, tsk.State())
+	})
+
+	t.Run("after expiry", func(t *testing.T) {
+		c := clock.NewFake(start.Add(time.Minute))
+		tsk := newTask()
+
+		assert.ErrorIs(t, tsk.Execute(task.WithClock(context.Background(), c)), task.ErrTimeout)
+		assert.Equal(t, task.TimedOut, tsk.State())
+		assert.Equal(t, 0, tsk.Attempts())
+	})
+}
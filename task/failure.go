@@ -0,0 +1,40 @@
+package task
+
+import "fmt"
+
+// FailurePolicy determines what happens to a task when one of its dependencies does not succeed.
+type FailurePolicy int
+
+const (
+	// SkipOnFailure marks the task as Skipped without running it. This is the default policy.
+	SkipOnFailure FailurePolicy = iota
+
+	// CancelOnFailure marks the task as Canceled without running it.
+	CancelOnFailure
+
+	// RunOnFailure runs the task anyway once all of its dependencies have completed.
+	RunOnFailure
+)
+
+// UpstreamError is the error of a task that was not run because one of its dependencies did not succeed.
+type UpstreamError struct {
+	// TaskID is the identifier of the dependency that did not succeed.
+	TaskID string
+
+	// State is the state the dependency finished in.
+	State State
+
+	// Err is the dependency's error.
+	Err error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("dependency %q %s", e.TaskID, e.State)
+	}
+	return fmt.Sprintf("dependency %q %s: %v", e.TaskID, e.State, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
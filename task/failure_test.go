@@ -0,0 +1,76 @@
+package task_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestUpstreamError(t *testing.T) {
+	cause := errors.New("extract failed")
+	err := &task.UpstreamError{TaskID: "extract", State: task.Failed, Err: cause}
+
+	assert.Equal(t, `dependency "extract" failed: extract failed`, err.Error())
+	assert.ErrorIs(t, err, cause)
+
+	wrapped := &task.UpstreamError{TaskID: "transform", State: task.Skipped, Err: err}
+	var upstream *task.UpstreamError
+	assert.ErrorAs(t, wrapped, &upstream)
+	assert.ErrorIs(t, wrapped, cause)
+}
+
+func TestTaskFailurePolicy(t *testing.T) {
+	dep := task.NewTask("dep", nil, task.LowPriority)
+	other := task.NewTask("other", nil, task.LowPriority)
+	tsk := task.NewTask("test_task", nil, task.LowPriority)
+
+	assert.Equal(t, task.SkipOnFailure, tsk.FailurePolicy())
+
+	tsk.SetFailurePolicy(task.CancelOnFailure)
+	tsk.AddDependency(other)
+	tsk.AddDependencyWithPolicy(dep, task.RunOnFailure)
+
+	assert.Equal(t, task.CancelOnFailure, tsk.DependencyPolicy(other))
+	assert.Equal(t, task.RunOnFailure, tsk.DependencyPolicy(dep))
+
+	tsk.RemoveDependency(dep)
+	assert.Equal(t, task.CancelOnFailure, tsk.DependencyPolicy(dep))
+}
+
+func TestTaskAbandon(t *testing.T) {
+	t.Run("pending", func(t *testing.T) {
+		cause := errors.New("upstream failed")
+		tsk := task.NewTask("test_task", nil, task.LowPriority)
+
+		err := tsk.Abandon(task.Skipped, cause)
+
+		assert.NoError(t, err)
+		assert.Equal(t, task.Skipped, tsk.State())
+		assert.Equal(t, cause, tsk.Err())
+		assert.NoError(t, tsk.Wait(context.Background()))
+	})
+
+	t.Run("non-terminal state", func(t *testing.T) {
+		tsk := task.NewTask("test_task", nil, task.LowPriority)
+
+		err := tsk.Abandon(task.Ready, nil)
+
+		assert.ErrorIs(t, err, task.ErrInvalidTransition)
+	})
+
+	t.Run("completed", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		_ = tsk.Execute(context.Background())
+
+		err := tsk.Abandon(task.Canceled, nil)
+
+		assert.ErrorIs(t, err, task.ErrInvalidTransition)
+		assert.Equal(t, task.Succeeded, tsk.State())
+	})
+}
@@ -0,0 +1,158 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Future represents the eventual result of a task that produces a value of type T.
+type Future[T any] struct {
+	task *Task
+}
+
+// NewFuture creates a new task with the given ID, function, and priority, and returns a Future for its result.
+// The underlying task must be submitted for execution like any other task.
+func NewFuture[T any](id string, fn func(context.Context) (T, error), priority Priority) *Future[T] {
+	f := &Future[T]{}
+	f.task = NewTask(id, func(ctx context.Context) error {
+		v, err := fn(ctx)
+		f.task.setValue(ctx, v)
+		return err
+	}, priority)
+	return f
+}
+
+// Task returns the task underlying the future.
+func (f *Future[T]) Task() *Task {
+	return f.task
+}
+
+// Done returns a channel that is closed when the future's task has completed execution.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.task.Done()
+}
+
+// Get blocks until the future's task has completed and returns its value and error, or until the context is canceled.
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	var zero T
+	if err := f.task.Wait(ctx); err != nil {
+		return zero, err
+	}
+	return f.value(), f.task.Err()
+}
+
+// value returns the value produced by the future's task, or the zero value of T if there is none.
+func (f *Future[T]) value() T {
+	v, _ := f.task.Value().(T)
+	return v
+}
+
+// Then returns a future that applies fn to the value of f once f has completed successfully, and submits its task
+// with submit, e.g. an Agent's SubmitTask, so that it runs on the same workers as any other task. The task depends
+// on f's task, which must already have been submitted, so if f does not succeed it is resolved according to its
+// failure policy without calling fn.
+func Then[T, U any](submit func(*Task) error, f *Future[T], id string, fn func(context.Context, T) (U, error)) (*Future[U], error) {
+	next := NewFuture(id, func(ctx context.Context) (U, error) {
+		return fn(ctx, f.value())
+	}, f.task.Priority())
+	next.task.AddDependency(f.task)
+	if err := submit(next.task); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// All returns a future that completes with the values of all the given futures, in order, once they have all
+// completed successfully, and submits its task with submit like Then. The task depends on the futures' tasks,
+// so it is resolved according to its failure policy as soon as any of them does not succeed.
+func All[T any](submit func(*Task) error, id string, futures ...*Future[T]) (*Future[[]T], error) {
+	all := NewFuture(id, func(ctx context.Context) ([]T, error) {
+		values := make([]T, len(futures))
+		for i, f := range futures {
+			values[i] = f.value()
+		}
+		return values, nil
+	}, LowPriority)
+	for _, f := range futures {
+		all.task.AddDependency(f.task)
+	}
+	if err := submit(all.task); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// Any returns a future that completes with the value of the first of the given futures to complete successfully.
+// If all of the futures fail, it fails with their combined errors. Its task is submitted with submit like Then,
+// but only once its outcome is known, since it does not depend on all of the futures. If that submission fails,
+// the task is canceled with the submission error.
+func Any[T any](submit func(*Task) error, id string, futures ...*Future[T]) *Future[T] {
+	var (
+		mu      sync.Mutex
+		decided bool
+		value   T
+		errs    = make([]error, 0, len(futures))
+	)
+	first := NewFuture(id, func(ctx context.Context) (T, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(errs) == len(futures) {
+			var zero T
+			if len(errs) == 0 {
+				return zero, errors.New("no futures given")
+			}
+			return zero, errors.Join(errs...)
+		}
+		return value, nil
+	}, LowPriority)
+
+	// decide submits the task once a future has succeeded or all of them have failed.
+	decide := func() {
+		if err := submit(first.task); err != nil {
+			_ = first.task.Abandon(Canceled, err)
+		}
+	}
+	// complete records the outcome of f, and returns true if it decides the outcome of the returned future.
+	complete := func(f *Future[T]) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if decided {
+			return false
+		}
+		if err := f.task.Err(); err != nil {
+			errs = append(errs, err)
+			decided = len(errs) == len(futures)
+		} else {
+			value = f.value()
+			decided = true
+		}
+		return decided
+	}
+
+	if len(futures) == 0 {
+		decide()
+		return first
+	}
+	for _, f := range futures {
+		f := f
+		var once sync.Once
+		done := func() {
+			once.Do(func() {
+				if complete(f) {
+					decide()
+				}
+			})
+		}
+		f.task.Watch(func(tr Transition) {
+			if tr.To.IsTerminal() {
+				done()
+			}
+		})
+		// The future may have completed before the watcher was registered.
+		if f.task.State().IsTerminal() {
+			done()
+		}
+	}
+	return first
+}
@@ -0,0 +1,251 @@
+package task_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/executor"
+	"github.com/CSXL/go-agent/resource"
+	"github.com/CSXL/go-agent/scheduler"
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestFuture(t *testing.T) {
+	t.Run("get value", func(t *testing.T) {
+		f := task.NewFuture("test_future", func(ctx context.Context) (int, error) {
+			return 42, nil
+		}, task.LowPriority)
+
+		go func() {
+			_ = f.Task().Execute(context.Background())
+		}()
+
+		v, err := f.Get(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 42, v)
+	})
+
+	t.Run("get error", func(t *testing.T) {
+		expectedErr := errors.New("future failed")
+		f := task.NewFuture("test_future", func(ctx context.Context) (int, error) {
+			return 0, expectedErr
+		}, task.LowPriority)
+
+		go func() {
+			_ = f.Task().Execute(context.Background())
+		}()
+
+		_, err := f.Get(context.Background())
+
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		f := task.NewFuture("test_future", func(ctx context.Context) (int, error) {
+			return 42, nil
+		}, task.LowPriority)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := f.Get(ctx)
+
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("done", func(t *testing.T) {
+		f := task.NewFuture("test_future", func(ctx context.Context) (string, error) {
+			return "done", nil
+		}, task.LowPriority)
+
+		_ = f.Task().Execute(context.Background())
+
+		select {
+		case <-f.Done():
+		default:
+			t.Fatal("expected future to be done")
+		}
+	})
+
+	t.Run("discards values of attempts that are no longer running", func(t *testing.T) {
+		release := make(chan struct{})
+		returned := make(chan struct{})
+		f := task.NewFuture("test_future", func(ctx context.Context) (int, error) {
+			if task.Attempt(ctx) == 2 {
+				return 2, nil
+			}
+			// The first attempt times out, but only returns once released.
+			defer close(returned)
+			<-release
+			return 1, nil
+		}, task.LowPriority)
+		f.Task().SetTimeout(10 * time.Millisecond)
+		f.Task().SetRetryPolicy(task.RetryPolicy{MaxAttempts: 2})
+
+		assert.Error(t, f.Task().Execute(context.Background()))
+		assert.NoError(t, f.Task().Execute(context.Background()))
+		close(release)
+		<-returned
+
+		assert.Never(t, func() bool {
+			v, _ := f.Get(context.Background())
+			return v != 2
+		}, 50*time.Millisecond, time.Millisecond)
+	})
+}
+
+// newSubmit returns the Submit function of a started scheduler, which is stopped when the test completes.
+func newSubmit(t *testing.T) func(*task.Task) error {
+	sch := scheduler.NewScheduler(executor.NewExecutor(2), resource.NewManager())
+	sch.Start()
+	t.Cleanup(sch.Stop)
+	return sch.Submit
+}
+
+// newFuture returns a future that produces v and err once release is closed, or immediately if release is nil.
+func newFuture(id string, v int, err error, release <-chan struct{}) *task.Future[int] {
+	return task.NewFuture(id, func(ctx context.Context) (int, error) {
+		if release != nil {
+			<-release
+		}
+		return v, err
+	}, task.LowPriority)
+}
+
+func TestFutureThen(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		submit := newSubmit(t)
+		release := make(chan struct{})
+		f := newFuture("test_future", 21, nil, release)
+		assert.NoError(t, submit(f.Task()))
+		doubled, err := task.Then(submit, f, "doubled", func(ctx context.Context, v int) (int, error) {
+			return v * 2, nil
+		})
+		assert.NoError(t, err)
+
+		close(release)
+		v, err := doubled.Get(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 42, v)
+	})
+
+	t.Run("upstream failure", func(t *testing.T) {
+		submit := newSubmit(t)
+		expectedErr := errors.New("future failed")
+		release := make(chan struct{})
+		f := newFuture("test_future", 0, expectedErr, release)
+		assert.NoError(t, submit(f.Task()))
+		next, err := task.Then(submit, f, "next", func(ctx context.Context, v int) (int, error) {
+			t.Error("continuation ran")
+			return v, nil
+		})
+		assert.NoError(t, err)
+
+		close(release)
+		_, err = next.Get(context.Background())
+
+		assert.ErrorIs(t, err, expectedErr)
+		assert.Equal(t, task.Skipped, next.Task().State())
+	})
+
+	t.Run("unsubmitted future", func(t *testing.T) {
+		submit := newSubmit(t)
+		f := newFuture("test_future", 0, nil, nil)
+		_, err := task.Then(submit, f, "next", func(ctx context.Context, v int) (int, error) {
+			return v, nil
+		})
+
+		assert.ErrorIs(t, err, scheduler.ErrUnknownDependency)
+	})
+}
+
+func TestFutureAll(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		submit := newSubmit(t)
+		release := make(chan struct{})
+		futures := []*task.Future[int]{
+			newFuture("a", 1, nil, release), newFuture("b", 2, nil, release), newFuture("c", 3, nil, release),
+		}
+		for _, f := range futures {
+			assert.NoError(t, submit(f.Task()))
+		}
+		all, err := task.All(submit, "all", futures...)
+		assert.NoError(t, err)
+
+		close(release)
+		values, err := all.Get(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3}, values)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		submit := newSubmit(t)
+		expectedErr := errors.New("future failed")
+		blocked := newFuture("a", 1, nil, make(chan struct{}))
+		failing := newFuture("b", 0, expectedErr, nil)
+		assert.NoError(t, submit(blocked.Task()))
+		assert.NoError(t, submit(failing.Task()))
+		all, err := task.All(submit, "all", blocked, failing)
+		assert.NoError(t, err)
+
+		_, err = all.Get(context.Background())
+
+		assert.ErrorIs(t, err, expectedErr)
+		blocked.Task().Cancel()
+	})
+}
+
+func TestFutureAny(t *testing.T) {
+	t.Run("first success", func(t *testing.T) {
+		submit := newSubmit(t)
+		failing := newFuture("a", 0, errors.New("future failed"), nil)
+		succeeding := newFuture("b", 2, nil, nil)
+		blocked := newFuture("c", 3, nil, make(chan struct{}))
+		assert.NoError(t, submit(blocked.Task()))
+		first := task.Any(submit, "any", failing, succeeding, blocked)
+
+		assert.NoError(t, submit(failing.Task()))
+		assert.NoError(t, failing.Task().Wait(context.Background()))
+		assert.NoError(t, submit(succeeding.Task()))
+		v, err := first.Get(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, v)
+		blocked.Task().Cancel()
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		submit := newSubmit(t)
+		errA := errors.New("a failed")
+		errB := errors.New("b failed")
+		a := newFuture("a", 0, errA, nil)
+		b := newFuture("b", 0, errB, nil)
+		first := task.Any(submit, "any", a, b)
+
+		assert.NoError(t, submit(a.Task()))
+		assert.NoError(t, submit(b.Task()))
+		_, err := first.Get(context.Background())
+
+		assert.ErrorIs(t, err, errA)
+		assert.ErrorIs(t, err, errB)
+	})
+
+	t.Run("submission fails", func(t *testing.T) {
+		stopped := errors.New("stopped")
+		f := newFuture("a", 1, nil, nil)
+		first := task.Any(func(*task.Task) error { return stopped }, "any", f)
+
+		_ = f.Task().Execute(context.Background())
+		_, err := first.Get(context.Background())
+
+		assert.ErrorIs(t, err, stopped)
+		assert.Equal(t, task.Canceled, first.Task().State())
+	})
+}
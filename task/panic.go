@@ -0,0 +1,40 @@
+package task
+
+import (
+	"context"
+	"fmt"
+)
+
+// PanicError is the error of a task whose function panicked.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine that panicked, captured when the panic was recovered.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// crashOnPanicKey is the context key that disables panic recovery.
+type crashOnPanicKey struct{}
+
+// WithCrashOnPanic returns a context under which tasks do not recover from panics in their function,
+// so that a panic crashes the process with its original stack trace. It is intended for debugging.
+func WithCrashOnPanic(ctx context.Context) context.Context {
+	return context.WithValue(ctx, crashOnPanicKey{}, true)
+}
+
+// crashOnPanic reports whether panics should not be recovered under the given context.
+func crashOnPanic(ctx context.Context) bool {
+	crash, _ := ctx.Value(crashOnPanicKey{}).(bool)
+	return crash
+}
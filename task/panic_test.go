@@ -0,0 +1,40 @@
+package task_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestTaskPanic(t *testing.T) {
+	t.Run("recovered", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			panic("boom")
+		}, task.LowPriority)
+
+		err := tsk.Execute(context.Background())
+
+		var panicErr *task.PanicError
+		assert.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "boom", panicErr.Value)
+		assert.Contains(t, string(panicErr.Stack), "panic_test.go")
+		assert.Equal(t, "task panicked: boom", err.Error())
+		assert.Equal(t, task.Failed, tsk.State())
+		assert.Equal(t, err, tsk.Err())
+	})
+
+	t.Run("error value", func(t *testing.T) {
+		cause := errors.New("boom")
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			panic(cause)
+		}, task.LowPriority)
+
+		err := tsk.Execute(context.Background())
+
+		assert.ErrorIs(t, err, cause)
+	})
+}
@@ -0,0 +1,88 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy describes how a failed task is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the task is executed, including the first attempt.
+	// A value of 1 or less disables retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries. Zero means no cap.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor by which the delay grows after each retry. Values below 1 are treated as 2.
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to the given fraction in either direction, e.g. 0.2 for ±20%.
+	Jitter float64
+
+	// MaxElapsedTime stops retrying once this much time has passed since the task first started. Zero means no limit.
+	MaxElapsedTime time.Duration
+}
+
+// Backoff returns the delay before the retry that follows the given number of completed attempts.
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempts-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// permanentError wraps an error that should not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as non-retryable, so a task returning it fails immediately regardless of its retry policy.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err has been marked as non-retryable.
+func IsPermanent(err error) bool {
+	var perr *permanentError
+	return errors.As(err, &perr)
+}
+
+// attemptKey is the context key for the current attempt number.
+type attemptKey struct{}
+
+// Attempt returns the attempt number of the task executing with the given context, starting at 1.
+// It returns 0 if the context does not belong to a task execution.
+func Attempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
@@ -0,0 +1,121 @@
+package task_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Run("exponential", func(t *testing.T) {
+		policy := task.RetryPolicy{InitialBackoff: 100 * time.Millisecond}
+
+		assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+		assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+		assert.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+	})
+
+	t.Run("max backoff", func(t *testing.T) {
+		policy := task.RetryPolicy{
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     250 * time.Millisecond,
+			Multiplier:     3,
+		}
+
+		assert.Equal(t, 250*time.Millisecond, policy.Backoff(2))
+	})
+
+	t.Run("jitter", func(t *testing.T) {
+		policy := task.RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}
+
+		for i := 0; i < 100; i++ {
+			delay := policy.Backoff(1)
+			assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+			assert.LessOrEqual(t, delay, 150*time.Millisecond)
+		}
+	})
+}
+
+func TestPermanent(t *testing.T) {
+	err := errors.New("fatal")
+
+	assert.True(t, task.IsPermanent(task.Permanent(err)))
+	assert.ErrorIs(t, task.Permanent(err), err)
+	assert.False(t, task.IsPermanent(err))
+	assert.NoError(t, task.Permanent(nil))
+}
+
+func TestTaskRetry(t *testing.T) {
+	t.Run("pending retry", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return errors.New("transient")
+		}, task.LowPriority)
+		tsk.SetRetryPolicy(task.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Second})
+
+		err := tsk.Execute(context.Background())
+		assert.Error(t, err)
+
+		delay, retry := tsk.PendingRetry()
+		assert.True(t, retry)
+		assert.Equal(t, time.Second, delay)
+		assert.True(t, tsk.FinishedAt().IsZero())
+
+		_ = tsk.Execute(context.Background())
+
+		_, retry = tsk.PendingRetry()
+		assert.False(t, retry)
+		assert.Equal(t, 2, tsk.Attempts())
+		assert.Error(t, tsk.Err())
+		assert.NoError(t, tsk.Wait(context.Background()))
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return task.Permanent(errors.New("fatal"))
+		}, task.LowPriority)
+		tsk.SetRetryPolicy(task.RetryPolicy{MaxAttempts: 3})
+
+		_ = tsk.Execute(context.Background())
+
+		_, retry := tsk.PendingRetry()
+		assert.False(t, retry)
+		assert.True(t, task.IsPermanent(tsk.Err()))
+	})
+
+	t.Run("max elapsed time", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return errors.New("transient")
+		}, task.LowPriority)
+		tsk.SetRetryPolicy(task.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Second,
+			MaxElapsedTime: 500 * time.Millisecond,
+		})
+
+		_ = tsk.Execute(context.Background())
+
+		_, retry := tsk.PendingRetry()
+		assert.False(t, retry)
+	})
+
+	t.Run("attempt in context", func(t *testing.T) {
+		var attempts []int
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			attempts = append(attempts, task.Attempt(ctx))
+			return errors.New("transient")
+		}, task.LowPriority)
+		tsk.SetRetryPolicy(task.RetryPolicy{MaxAttempts: 3})
+
+		for i := 0; i < 3; i++ {
+			_ = tsk.Execute(context.Background())
+		}
+
+		assert.Equal(t, []int{1, 2, 3}, attempts)
+		assert.Equal(t, 0, task.Attempt(context.Background()))
+	})
+}
@@ -0,0 +1,137 @@
+package task
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidTransition is returned when a task is moved to a state that cannot follow its current state.
+var ErrInvalidTransition = errors.New("invalid task state transition")
+
+// State represents a stage in the lifecycle of a task.
+type State int
+
+const (
+	// Pending is the state of a task that has been created but is not yet ready to run,
+	// including a task waiting for its next retry or to be run again after being preempted.
+	Pending State = iota
+
+	// Ready is the state of a task that is queued for execution.
+	Ready
+
+	// Running is the state of a task that is currently executing.
+	Running
+
+	// Succeeded is the state of a task that completed without error.
+	Succeeded
+
+	// Failed is the state of a task that completed with an error.
+	Failed
+
+	// Canceled is the state of a task that was canceled before it completed.
+	Canceled
+
+	// TimedOut is the state of a task that exceeded its timeout or deadline.
+	TimedOut
+
+	// Skipped is the state of a task that was not run because one of its dependencies did not succeed.
+	Skipped
+)
+
+// transitions lists the states that may follow each state.
+var transitions = map[State][]State{
+	Pending: {Ready, Canceled, TimedOut, Skipped},
+	Ready:   {Running, Canceled, TimedOut},
+	Running: {Pending, Succeeded, Failed, Canceled, TimedOut},
+}
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Ready:
+		return "ready"
+	case Running:
+		return "running"
+	case Succeeded:
+		return "succeeded"
+	case Failed:
+		return "failed"
+	case Canceled:
+		return "canceled"
+	case TimedOut:
+		return "timed out"
+	case Skipped:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// IsTerminal returns true if no further transitions can follow the state.
+func (s State) IsTerminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// CanTransitionTo returns true if next may directly follow the state.
+func (s State) CanTransitionTo(next State) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns the shortest sequence of states through which a task can move from one state to another,
+// excluding from, or nil if there is none.
+func path(from, to State) []State {
+	prev := map[State]State{from: from}
+	queue := []State{from}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		if s == to {
+			var steps []State
+			for ; s != from; s = prev[s] {
+				steps = append([]State{s}, steps...)
+			}
+			return steps
+		}
+		for _, next := range transitions[s] {
+			if _, seen := prev[next]; !seen {
+				prev[next] = s
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// Transition describes a change in a task's state.
+type Transition struct {
+	// TaskID is the identifier of the task that changed state.
+	TaskID string
+
+	// From is the state the task was in before the transition.
+	From State
+
+	// To is the state the task is in after the transition.
+	To State
+
+	// At is the time the transition occurred.
+	At time.Time
+}
+
+// watcher is a registered subscriber to a task's state transitions.
+type watcher struct {
+	id int
+	fn func(Transition)
+}
+
+// delivery is a transition waiting to be delivered to the watchers registered when it happened.
+type delivery struct {
+	watchers   []watcher
+	transition Transition
+}
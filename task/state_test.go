@@ -0,0 +1,43 @@
+package task_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CSXL/go-agent/task"
+)
+
+func TestState(t *testing.T) {
+	t.Run("valid transitions", func(t *testing.T) {
+		assert.True(t, task.Pending.CanTransitionTo(task.Ready))
+		assert.True(t, task.Ready.CanTransitionTo(task.Running))
+		assert.True(t, task.Running.CanTransitionTo(task.Succeeded))
+		assert.True(t, task.Running.CanTransitionTo(task.Failed))
+		assert.True(t, task.Running.CanTransitionTo(task.Canceled))
+		assert.True(t, task.Running.CanTransitionTo(task.TimedOut))
+		assert.True(t, task.Running.CanTransitionTo(task.Pending))
+	})
+
+	t.Run("invalid transitions", func(t *testing.T) {
+		assert.False(t, task.Pending.CanTransitionTo(task.Running))
+		assert.False(t, task.Ready.CanTransitionTo(task.Succeeded))
+		assert.False(t, task.Succeeded.CanTransitionTo(task.Running))
+		assert.False(t, task.Failed.CanTransitionTo(task.Pending))
+	})
+
+	t.Run("terminal states", func(t *testing.T) {
+		for _, s := range []task.State{task.Succeeded, task.Failed, task.Canceled, task.TimedOut, task.Skipped} {
+			assert.True(t, s.IsTerminal(), s.String())
+		}
+		for _, s := range []task.State{task.Pending, task.Ready, task.Running} {
+			assert.False(t, s.IsTerminal(), s.String())
+		}
+	})
+
+	t.Run("string", func(t *testing.T) {
+		assert.Equal(t, "pending", task.Pending.String())
+		assert.Equal(t, "timed out", task.TimedOut.String())
+		assert.Equal(t, "unknown", task.State(-1).String())
+	})
+}
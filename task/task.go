@@ -3,30 +3,100 @@ package task
 import (
 	"context"
 	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
 )
 
-// Priority represents the priority level of a task.
+// ErrTimeout is returned by a task that exceeded its timeout or deadline.
+var ErrTimeout = errors.New("task timed out")
+
+// ErrAlreadySubmitted is returned when a task that has already been submitted is submitted again.
+var ErrAlreadySubmitted = errors.New("task already submitted")
+
+// ErrPreempted is the cause with which the context of a preempted task's attempt is canceled.
+var ErrPreempted = errors.New("task preempted")
+
+// Priority represents the priority level of a task. Any integer is a valid priority,
+// and tasks with higher priorities run first; the named levels are common presets.
 type Priority int
 
 const (
 	// LowPriority represents a low-priority task.
-	LowPriority Priority = iota
+	LowPriority Priority = 0
 
 	// MediumPriority represents a medium-priority task.
-	MediumPriority
+	MediumPriority Priority = 50
 
 	// HighPriority represents a high-priority task.
-	HighPriority
+	HighPriority Priority = 100
 )
 
+// Result is a snapshot of the outcome of a task's execution.
+type Result struct {
+	// ID is the task's unique identifier.
+	ID string
+
+	// Err is the error returned by the task's final execution, if any.
+	Err error
+
+	// StartedAt is the time the task first started executing.
+	StartedAt time.Time
+
+	// FinishedAt is the time the task finished executing. It is zero until the task has completed.
+	FinishedAt time.Time
+
+	// Attempts is the number of times the task has been executed.
+	Attempts int
+
+	// State is the task's lifecycle state.
+	State State
+}
+
+// Requirement is a number of units of a named resource that a task needs while it runs.
+type Requirement struct {
+	// Resource is the name the resource is registered under.
+	Resource string
+
+	// Units is the number of units of the resource the task needs.
+	Units int
+}
+
 // Task represents a unit of work that can be executed concurrently.
 type Task struct {
+	mu           sync.Mutex
 	id           string
 	fn           func(context.Context) error
 	priority     Priority
+	group        string
+	key          string
+	requirements []Requirement
 	dependencies []*Task
-	cancel       context.CancelFunc
+	onFailure    FailurePolicy
+	edgePolicies map[*Task]FailurePolicy
+	cancel       context.CancelCauseFunc
+	canceledBy   error
+	preemptible  bool
+	preemptions  int
 	done         chan struct{}
+	err          error
+	startedAt    time.Time
+	finishedAt   time.Time
+	attempts     int
+	value        interface{}
+	retryPolicy  RetryPolicy
+	retryDelay   time.Duration
+	retryPending bool
+	timeout      time.Duration
+	deadline     time.Time
+	expireQueued bool
+	submittedAt  time.Time
+	state        State
+	watchers     []watcher
+	nextWatcher  int
+	deliveries   []delivery
+	delivering   bool
 }
 
 // NewTask creates a new task with the given ID, function, and priority.
@@ -49,6 +119,17 @@ func (t *Task) Dependencies() []*Task {
 	return t.dependencies
 }
 
+// AddDependencyWithPolicy adds a dependency to the task, overriding the task's failure policy for that dependency.
+func (t *Task) AddDependencyWithPolicy(dependency *Task, policy FailurePolicy) {
+	t.AddDependency(dependency)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.edgePolicies == nil {
+		t.edgePolicies = make(map[*Task]FailurePolicy)
+	}
+	t.edgePolicies[dependency] = policy
+}
+
 // RemoveDependency removes a dependency from the task.
 func (t *Task) RemoveDependency(dependency *Task) {
 	for i, dep := range t.dependencies {
@@ -57,6 +138,33 @@ func (t *Task) RemoveDependency(dependency *Task) {
 			break
 		}
 	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.edgePolicies, dependency)
+}
+
+// FailurePolicy returns the policy applied when one of the task's dependencies does not succeed.
+func (t *Task) FailurePolicy() FailurePolicy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.onFailure
+}
+
+// SetFailurePolicy sets the policy applied when one of the task's dependencies does not succeed.
+func (t *Task) SetFailurePolicy(policy FailurePolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onFailure = policy
+}
+
+// DependencyPolicy returns the failure policy that applies to the given dependency.
+func (t *Task) DependencyPolicy(dependency *Task) FailurePolicy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if policy, ok := t.edgePolicies[dependency]; ok {
+		return policy
+	}
+	return t.onFailure
 }
 
 // IsReady returns true if the task has no dependencies or all of its dependencies have completed execution.
@@ -78,25 +186,507 @@ func (t *Task) ID() string {
 
 // Priority returns the task's priority level.
 func (t *Task) Priority() Priority {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return t.priority
 }
 
-// SetPriority sets the task's priority level.
+// SetPriority sets the task's priority level. It does not reorder a task that is already queued;
+// use the scheduler's UpdatePriority for that.
 func (t *Task) SetPriority(priority Priority) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.priority = priority
 }
 
+// Group returns the key of the group or tenant the task belongs to. The default group is the empty string.
+func (t *Task) Group() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.group
+}
+
+// SetGroup sets the key of the group or tenant the task belongs to. Groups share workers according to
+// their weights when they have tasks of the same priority queued. It must be called before the task is submitted.
+func (t *Task) SetGroup(group string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.group = group
+}
+
+// IdempotencyKey returns the key identifying the logical work the task performs, or "" if it has none.
+func (t *Task) IdempotencyKey() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.key
+}
+
+// SetIdempotencyKey sets the key identifying the logical work the task performs. A scheduler runs only one of
+// the tasks submitted with the same key at a time, and the others share its outcome. It must be called before
+// the task is submitted.
+func (t *Task) SetIdempotencyKey(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.key = key
+}
+
+// Require declares that the task needs the given number of units of a named resource while it runs.
+// The scheduler only dispatches the task once all of its requirements can be acquired together,
+// and releases them when it finishes. It must be called before the task is submitted.
+func (t *Task) Require(resource string, units int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requirements = append(t.requirements, Requirement{Resource: resource, Units: units})
+}
+
+// Requirements returns the resources the task needs while it runs.
+func (t *Task) Requirements() []Requirement {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Requirement(nil), t.requirements...)
+}
+
+// Preemptible returns true if the task may be preempted by higher-priority tasks.
+func (t *Task) Preemptible() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.preemptible
+}
+
+// SetPreemptible sets whether the task may be preempted by higher-priority tasks. Tasks are not preemptible by default.
+func (t *Task) SetPreemptible(preemptible bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.preemptible = preemptible
+}
+
+// Preemptions returns the number of times the task has been preempted.
+func (t *Task) Preemptions() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.preemptions
+}
+
+// Preempt cancels the running attempt of the task with ErrPreempted as the cause, and returns false if
+// the task is not running. Unlike a canceled task, a preempted task returns to the Pending state with a
+// pending retry, so that it is run again; the preempted attempt does not count towards its retry policy.
+func (t *Task) Preempt() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state != Running || t.canceledBy != nil {
+		return false
+	}
+	t.cancel(ErrPreempted)
+	return true
+}
+
+// RetryPolicy returns the task's retry policy.
+func (t *Task) RetryPolicy() RetryPolicy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.retryPolicy
+}
+
+// SetRetryPolicy sets the policy used to retry the task when it fails.
+func (t *Task) SetRetryPolicy(policy RetryPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.retryPolicy = policy
+}
+
+// Timeout returns the maximum duration of each execution attempt, or zero if there is none.
+func (t *Task) Timeout() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timeout
+}
+
+// SetTimeout sets the maximum duration of each execution attempt. Zero disables the timeout.
+func (t *Task) SetTimeout(timeout time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timeout = timeout
+}
+
+// Deadline returns the time by which the task must finish, or the zero time if there is none.
+func (t *Task) Deadline() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deadline
+}
+
+// SetDeadline sets the time by which the task must finish. The zero time disables the deadline.
+func (t *Task) SetDeadline(deadline time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.deadline = deadline
+}
+
+// ExpireBeforeStart reports whether the task's timeout and deadline also apply to time spent waiting to start.
+func (t *Task) ExpireBeforeStart() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.expireQueued
+}
+
+// SetExpireBeforeStart sets whether the task's timeout and deadline also apply to time spent waiting to start.
+// When enabled, the timeout is measured from submission and a task that expires before it starts is never run.
+func (t *Task) SetExpireBeforeStart(expire bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expireQueued = expire
+}
+
+// SubmittedAt returns the time the task was first submitted for execution, or the zero time if it has not been.
+func (t *Task) SubmittedAt() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.submittedAt
+}
+
+// MarkSubmitted records the current time as the time the task was submitted for execution,
+// and returns an error if the task has already been submitted.
+func (t *Task) MarkSubmitted() error {
+	return t.MarkSubmittedAt(time.Now())
+}
+
+// MarkSubmittedAt records at as the time the task was submitted for execution. It is called by the scheduler
+// with the time of its clock, and returns an error if the task has already been submitted.
+func (t *Task) MarkSubmittedAt(at time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.submittedAt.IsZero() {
+		return ErrAlreadySubmitted
+	}
+	t.submittedAt = at
+	return nil
+}
+
+// PendingRetry returns the delay before the task should be executed again, and true if its last attempt
+// failed and will be retried. A task with a pending retry has not completed.
+func (t *Task) PendingRetry() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.retryDelay, t.retryPending
+}
+
+// Err returns the error returned by the task's execution, or nil if it succeeded or has not finished.
+func (t *Task) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// StartedAt returns the time the task first started executing, or the zero time if it has not started.
+func (t *Task) StartedAt() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.startedAt
+}
+
+// FinishedAt returns the time the task finished executing, or the zero time if it has not finished.
+func (t *Task) FinishedAt() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.finishedAt
+}
+
+// Attempts returns the number of times the task has been executed.
+func (t *Task) Attempts() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.attempts
+}
+
+// Value returns the value produced by the task, or nil if the task does not produce one.
+func (t *Task) Value() interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.value
+}
+
+// setValue records the value produced by the task's attempt executing with ctx. The value is discarded if that
+// attempt is no longer running, e.g. because it timed out or was canceled without its function returning.
+func (t *Task) setValue(ctx context.Context, v interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state != Running || t.attempts != Attempt(ctx) {
+		return
+	}
+	t.value = v
+}
+
+// Done returns a channel that is closed when the task has completed execution.
+func (t *Task) Done() <-chan struct{} {
+	return t.done
+}
+
+// Result returns a snapshot of the task's outcome.
+func (t *Task) Result() Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Result{
+		ID:         t.id,
+		Err:        t.err,
+		StartedAt:  t.startedAt,
+		FinishedAt: t.finishedAt,
+		Attempts:   t.attempts,
+		State:      t.state,
+	}
+}
+
+// State returns the task's current lifecycle state.
+func (t *Task) State() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// Watch registers fn to be called with every subsequent state transition of the task, and returns a function
+// that unregisters it. fn is called after the transition in a separate goroutine, one transition at a time and in
+// the order the task made them, so it may call back into whatever made the transition, e.g. the scheduler.
+func (t *Task) Watch(fn func(Transition)) (unwatch func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.nextWatcher
+	t.nextWatcher++
+	t.watchers = append(t.watchers, watcher{id: id, fn: fn})
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for i, w := range t.watchers {
+			if w.id == id {
+				t.watchers = append(t.watchers[:i:i], t.watchers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// MarkReady moves a pending task to the Ready state. It is called by the scheduler when the task is queued for execution.
+func (t *Task) MarkReady() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tr, err := t.setState(Ready)
+	if err != nil {
+		return err
+	}
+	t.notify(tr)
+	return nil
+}
+
+// Abandon completes a task that has not started running with the given terminal state and error,
+// without executing it. It is used by the scheduler to resolve tasks that will never run.
+func (t *Task) Abandon(state State, err error) error {
+	if !state.IsTerminal() {
+		return fmt.Errorf("%w: %s is not a terminal state", ErrInvalidTransition, state)
+	}
+	return t.resolve(state, err, true)
+}
+
+// setState moves the task to the given state if the transition is valid. It must be called with t.mu held.
+func (t *Task) setState(to State) (Transition, error) {
+	if !t.state.CanTransitionTo(to) {
+		return Transition{}, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, t.state, to)
+	}
+	tr := Transition{TaskID: t.id, From: t.state, To: to, At: time.Now()}
+	t.state = to
+	return tr, nil
+}
+
+// notify queues the given transitions for delivery to the current watchers, and starts delivering them
+// if no delivery is in progress. It must be called with t.mu held.
+func (t *Task) notify(trs ...Transition) {
+	if len(t.watchers) == 0 {
+		return
+	}
+	for _, tr := range trs {
+		t.deliveries = append(t.deliveries, delivery{watchers: t.watchers, transition: tr})
+	}
+	if !t.delivering {
+		t.delivering = true
+		go t.deliver()
+	}
+}
+
+// deliver calls the watchers of each queued transition in order until none are left. A watcher that
+// is unregistered before a transition is delivered is not called with it.
+func (t *Task) deliver() {
+	for {
+		t.mu.Lock()
+		if len(t.deliveries) == 0 {
+			t.delivering = false
+			t.mu.Unlock()
+			return
+		}
+		d := t.deliveries[0]
+		t.deliveries[0] = delivery{}
+		t.deliveries = t.deliveries[1:]
+		t.mu.Unlock()
+
+		for _, w := range d.watchers {
+			if t.watching(w.id) {
+				w.fn(d.transition)
+			}
+		}
+	}
+}
+
+// watching returns true if the watcher with the given ID is still registered.
+func (t *Task) watching(id int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, w := range t.watchers {
+		if w.id == id {
+			return true
+		}
+	}
+	return false
+}
+
 // Execute runs the task and returns any error encountered during execution.
+// If the task fails and its retry policy allows another attempt, the task is left incomplete
+// with a pending retry instead of being marked as done.
 func (t *Task) Execute(ctx context.Context) error {
-	ctx, t.cancel = context.WithCancel(ctx)
-	defer close(t.done)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if t.State() == Pending {
+		if err := t.MarkReady(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	// The queue expiry is measured with the clock the task was submitted by; see WithClock.
+	if expiry, ok := t.QueueExpiry(); ok && !clockNow(ctx).Before(expiry) {
+		err := fmt.Errorf("%w: expired before start", ErrTimeout)
+		t.finish(TimedOut, err)
+		return err
+	}
+
+	t.mu.Lock()
+	tr, err := t.setState(Running)
+	if err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	t.cancel = cancel
+	t.attempts++
+	attempt := t.attempts
+	t.retryPending = false
+	if t.startedAt.IsZero() {
+		t.startedAt = now
+	}
+	t.notify(tr)
+	t.mu.Unlock()
+
+	runCtx := ctx
+	if deadline, ok := t.attemptDeadline(now); ok {
+		var cancelRun context.CancelFunc
+		runCtx, cancelRun = context.WithDeadline(ctx, deadline)
+		defer cancelRun()
+	}
+
+	err = t.run(context.WithValue(runCtx, attemptKey{}, attempt))
+	switch {
+	case err == nil:
+		t.finish(Succeeded, nil)
+	case ctx.Err() != nil:
+		cause := t.cancelCause(ctx)
+		err = cancellation(ctx.Err(), cause)
+		if !errors.Is(cause, ErrPreempted) || !t.requeue() {
+			t.finish(Canceled, err)
+		}
+	case runCtx.Err() != nil:
+		err = fmt.Errorf("%w: %w", ErrTimeout, context.DeadlineExceeded)
+		if !t.scheduleRetry(err) {
+			t.finish(TimedOut, err)
+		}
+	default:
+		if !t.scheduleRetry(err) {
+			t.finish(Failed, err)
+		}
+	}
+	return err
+}
+
+// cancelCause returns the reason the context of the task's attempt was canceled. An explicit cancellation
+// takes precedence over a preemption that canceled the context first.
+func (t *Task) cancelCause(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.canceledBy != nil {
+		return t.canceledBy
+	}
+	return context.Cause(ctx)
+}
+
+// requeue returns a preempted task to the Pending state with a pending retry and no backoff,
+// and returns false if the transition is not valid.
+func (t *Task) requeue() bool {
+	t.mu.Lock()
+	tr, err := t.setState(Pending)
+	if err != nil {
+		t.mu.Unlock()
+		return false
+	}
+	t.preemptions++
+	t.retryDelay = 0
+	t.retryPending = true
+	t.notify(tr)
+	t.mu.Unlock()
+	return true
+}
+
+// attemptDeadline returns the time by which an attempt started at now must finish, if the task has a timeout or deadline.
+func (t *Task) attemptDeadline(now time.Time) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return earliest(t.deadline, t.timeout, now)
+}
+
+// QueueExpiry returns the time after which the task may no longer start, if it expires before start.
+func (t *Task) QueueExpiry() (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.expireQueued {
+		return time.Time{}, false
+	}
+	if t.submittedAt.IsZero() {
+		return t.deadline, !t.deadline.IsZero()
+	}
+	return earliest(t.deadline, t.timeout, t.submittedAt)
+}
+
+// earliest returns the earlier of deadline and from+timeout, ignoring whichever is unset.
+func earliest(deadline time.Time, timeout time.Duration, from time.Time) (time.Time, bool) {
+	if timeout > 0 {
+		if expiry := from.Add(timeout); deadline.IsZero() || expiry.Before(deadline) {
+			return expiry, true
+		}
+	}
+	return deadline, !deadline.IsZero()
+}
+
+// run invokes the task function, returning early if the context is canceled.
+func (t *Task) run(ctx context.Context) error {
 	if t.fn == nil {
-		return errors.New("task function is nil")
+		return Permanent(errors.New("task function is nil"))
 	}
 
-	// Wrap the task function to handle context cancellation.
+	// Wrap the task function to handle context cancellation and recover from panics.
 	errChan := make(chan error, 1)
+	recoverPanics := !crashOnPanic(ctx)
 	go func() {
+		if recoverPanics {
+			defer func() {
+				if r := recover(); r != nil {
+					errChan <- &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+		}
 		errChan <- t.fn(ctx)
 	}()
 
@@ -108,11 +698,161 @@ func (t *Task) Execute(ctx context.Context) error {
 	}
 }
 
-// Cancel stops the task's execution if it's currently running.
+// scheduleRetry reports whether the task should be retried after failing with err, and if so
+// records the backoff and returns the task to the Pending state.
+func (t *Task) scheduleRetry(err error) bool {
+	if err == nil || IsPermanent(err) {
+		return false
+	}
+
+	t.mu.Lock()
+	delay, ok := t.retryBackoff()
+	if !ok {
+		t.mu.Unlock()
+		return false
+	}
+	tr, err := t.setState(Pending)
+	if err != nil {
+		t.mu.Unlock()
+		return false
+	}
+	t.retryDelay = delay
+	t.retryPending = true
+	t.notify(tr)
+	t.mu.Unlock()
+	return true
+}
+
+// retryBackoff returns the delay before the next attempt, and false if the retry policy allows no further attempts.
+// It must be called with t.mu held.
+func (t *Task) retryBackoff() (time.Duration, bool) {
+	policy := t.retryPolicy
+	attempts := t.attempts - t.preemptions
+	if attempts >= policy.MaxAttempts {
+		return 0, false
+	}
+	delay := policy.Backoff(attempts)
+	if policy.MaxElapsedTime > 0 && time.Since(t.startedAt)+delay > policy.MaxElapsedTime {
+		return 0, false
+	}
+	if !t.deadline.IsZero() && !time.Now().Add(delay).Before(t.deadline) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// finish records the outcome of the task, moves it to the given terminal state and marks it as done.
+// It has no effect and returns an error if the transition is not valid, e.g. because the task has
+// already reached a terminal state.
+func (t *Task) finish(state State, err error) error {
+	return t.resolve(state, err, false)
+}
+
+// resolve moves the task to the given terminal state like finish. If unstarted is true, it also fails
+// if the task is running, so that a task is never resolved while its function may still be executing.
+func (t *Task) resolve(state State, err error, unstarted bool) error {
+	t.mu.Lock()
+	if unstarted && t.state != Pending && t.state != Ready {
+		current := t.state
+		t.mu.Unlock()
+		return fmt.Errorf("%w: cannot resolve a task that is %s", ErrInvalidTransition, current)
+	}
+	tr, terr := t.setState(state)
+	if terr != nil {
+		t.mu.Unlock()
+		return terr
+	}
+	t.err = err
+	t.finishedAt = tr.At
+	t.notify(tr)
+	t.mu.Unlock()
+
+	close(t.done)
+	return nil
+}
+
+// Follow makes the task share the execution of original instead of running itself: once original completes,
+// the task completes with the same state, error, value, start time and number of attempts. It is used by the
+// scheduler to coalesce duplicate submissions. A task that is canceled or started first is not affected.
+func (t *Task) Follow(original *Task) {
+	original.Watch(func(tr Transition) {
+		if tr.To.IsTerminal() {
+			t.adopt(original)
+		}
+	})
+	if original.State().IsTerminal() {
+		t.adopt(original)
+	}
+}
+
+// adopt completes the task with the outcome of original, if it has not started.
+func (t *Task) adopt(original *Task) {
+	res := original.Result()
+	value := original.Value()
+
+	t.mu.Lock()
+	if (t.state != Pending && t.state != Ready) || !res.State.IsTerminal() {
+		t.mu.Unlock()
+		return
+	}
+	// The task shares original's execution instead of running itself. It moves through the states that lead
+	// to original's terminal state, e.g. from Ready through Running to Succeeded, so that watchers only see
+	// valid transitions. Every terminal state can be reached from Pending and Ready.
+	var trs []Transition
+	for _, to := range path(t.state, res.State) {
+		tr, _ := t.setState(to)
+		trs = append(trs, tr)
+	}
+	t.err = res.Err
+	t.value = value
+	t.startedAt = res.StartedAt
+	t.attempts = res.Attempts
+	t.finishedAt = trs[len(trs)-1].At
+	t.notify(trs...)
+	t.mu.Unlock()
+
+	close(t.done)
+}
+
+// Cancel stops the task's execution if it's currently running, or prevents it from running if it has not started.
 func (t *Task) Cancel() {
-	if t.cancel != nil {
-		t.cancel()
+	t.CancelWithCause(nil)
+}
+
+// CancelWithCause cancels the task like Cancel, recording cause as the reason. A running task's context is
+// canceled with the cause, and a task that has not started is marked as Canceled with an error wrapping both
+// context.Canceled and the cause. A nil cause is equivalent to context.Canceled. It has no effect on a completed task.
+func (t *Task) CancelWithCause(cause error) {
+	if cause == nil {
+		cause = context.Canceled
+	}
+	for {
+		t.mu.Lock()
+		state, cancel := t.state, t.cancel
+		if state == Running {
+			t.canceledBy = cause
+		}
+		t.mu.Unlock()
+
+		switch {
+		case state.IsTerminal():
+			return
+		case state == Running:
+			cancel(cause)
+			return
+		case t.resolve(Canceled, cancellation(context.Canceled, cause), true) == nil:
+			return
+		}
+		// The task started running in the meantime, so cancel its context instead.
+	}
+}
+
+// cancellation returns the error of a task canceled with the given context error and cause.
+func cancellation(err, cause error) error {
+	if cause == nil || cause == err {
+		return err
 	}
+	return fmt.Errorf("%w: %w", err, cause)
 }
 
 // Wait blocks until the task has completed execution or the context is canceled.
@@ -2,6 +2,7 @@ package task_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -76,7 +77,10 @@ func TestTaskCancel(t *testing.T) {
 		tsk.Cancel()
 		err := tsk.Execute(context.Background())
 
-		assert.NoError(t, err)
+		assert.ErrorIs(t, err, task.ErrInvalidTransition)
+		assert.Equal(t, task.Canceled, tsk.State())
+		assert.Equal(t, context.Canceled, tsk.Err())
+		assert.Equal(t, 0, tsk.Attempts())
 	})
 
 	t.Run("cancel during execute", func(t *testing.T) {
@@ -161,3 +165,477 @@ func TestTaskDependencies(t *testing.T) {
 		assert.False(t, tsk.IsReady())
 	})
 }
+
+func TestTaskGroup(t *testing.T) {
+	tsk := task.NewTask("test_task", func(ctx context.Context) error {
+		return nil
+	}, task.LowPriority)
+	assert.Equal(t, "", tsk.Group())
+
+	tsk.SetGroup("team-a")
+	assert.Equal(t, "team-a", tsk.Group())
+}
+
+func TestTaskIdempotencyKey(t *testing.T) {
+	tsk := task.NewTask("test_task", nil, task.LowPriority)
+	assert.Empty(t, tsk.IdempotencyKey())
+	tsk.SetIdempotencyKey("webhook-42")
+	assert.Equal(t, "webhook-42", tsk.IdempotencyKey())
+}
+
+func TestTaskRequirements(t *testing.T) {
+	tsk := task.NewTask("test_task", func(ctx context.Context) error {
+		return nil
+	}, task.LowPriority)
+	assert.Empty(t, tsk.Requirements())
+
+	tsk.Require("gpu", 2)
+	tsk.Require("db", 1)
+	assert.Equal(t, []task.Requirement{{Resource: "gpu", Units: 2}, {Resource: "db", Units: 1}}, tsk.Requirements())
+}
+
+func TestTaskResult(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+
+		_ = tsk.Execute(context.Background())
+
+		res := tsk.Result()
+		assert.Equal(t, "test_task", res.ID)
+		assert.NoError(t, res.Err)
+		assert.Equal(t, 1, res.Attempts)
+		assert.False(t, res.StartedAt.IsZero())
+		assert.False(t, res.FinishedAt.Before(res.StartedAt))
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("task failed")
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return expectedErr
+		}, task.LowPriority)
+
+		go func() {
+			_ = tsk.Execute(context.Background())
+		}()
+
+		err := tsk.Wait(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedErr, tsk.Err())
+		assert.Equal(t, 1, tsk.Attempts())
+	})
+
+	t.Run("not started", func(t *testing.T) {
+		tsk := task.NewTask("test_task", nil, task.LowPriority)
+
+		res := tsk.Result()
+		assert.NoError(t, res.Err)
+		assert.Equal(t, 0, res.Attempts)
+		assert.True(t, res.StartedAt.IsZero())
+		assert.True(t, res.FinishedAt.IsZero())
+	})
+}
+
+func TestTaskTimeout(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, task.LowPriority)
+		tsk.SetTimeout(100 * time.Millisecond)
+
+		err := tsk.Execute(context.Background())
+
+		assert.ErrorIs(t, err, task.ErrTimeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorIs(t, tsk.Err(), task.ErrTimeout)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			time.Sleep(500 * time.Millisecond)
+			return nil
+		}, task.LowPriority)
+		tsk.SetDeadline(time.Now().Add(100 * time.Millisecond))
+
+		err := tsk.Execute(context.Background())
+
+		assert.ErrorIs(t, err, task.ErrTimeout)
+	})
+
+	t.Run("finishes in time", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		tsk.SetTimeout(time.Second)
+
+		err := tsk.Execute(context.Background())
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("parent canceled", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			time.Sleep(500 * time.Millisecond)
+			return nil
+		}, task.LowPriority)
+		tsk.SetTimeout(time.Second)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := tsk.Execute(ctx)
+
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("expire before start", func(t *testing.T) {
+		called := false
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			called = true
+			return nil
+		}, task.LowPriority)
+		tsk.SetTimeout(50 * time.Millisecond)
+		tsk.SetExpireBeforeStart(true)
+		tsk.MarkSubmitted()
+
+		time.Sleep(100 * time.Millisecond)
+		err := tsk.Execute(context.Background())
+
+		assert.ErrorIs(t, err, task.ErrTimeout)
+		assert.False(t, called)
+		assert.Equal(t, 0, tsk.Attempts())
+	})
+
+	t.Run("queue time ignored by default", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		tsk.SetTimeout(50 * time.Millisecond)
+		tsk.MarkSubmitted()
+
+		time.Sleep(100 * time.Millisecond)
+		err := tsk.Execute(context.Background())
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestTaskState(t *testing.T) {
+	t.Run("lifecycle", func(t *testing.T) {
+		transitions := make(chan task.Transition, 3)
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		tsk.Watch(func(tr task.Transition) {
+			transitions <- tr
+		})
+
+		assert.Equal(t, task.Pending, tsk.State())
+		assert.NoError(t, tsk.MarkReady())
+		assert.Equal(t, task.Ready, tsk.State())
+
+		_ = tsk.Execute(context.Background())
+
+		assert.Equal(t, task.Succeeded, tsk.State())
+		assert.Equal(t, task.Succeeded, tsk.Result().State)
+		tr := <-transitions
+		assert.Equal(t, task.Pending, tr.From)
+		assert.Equal(t, task.Ready, tr.To)
+		assert.Equal(t, task.Running, (<-transitions).To)
+		tr = <-transitions
+		assert.Equal(t, task.Succeeded, tr.To)
+		assert.Equal(t, "test_task", tr.TaskID)
+	})
+
+	t.Run("outcomes", func(t *testing.T) {
+		failed := task.NewTask("failed", func(ctx context.Context) error {
+			return errors.New("task failed")
+		}, task.LowPriority)
+		_ = failed.Execute(context.Background())
+		assert.Equal(t, task.Failed, failed.State())
+
+		timedOut := task.NewTask("timed_out", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, task.LowPriority)
+		timedOut.SetTimeout(10 * time.Millisecond)
+		_ = timedOut.Execute(context.Background())
+		assert.Equal(t, task.TimedOut, timedOut.State())
+
+		canceled := task.NewTask("canceled", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, task.LowPriority)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			canceled.Cancel()
+		}()
+		_ = canceled.Execute(context.Background())
+		assert.Equal(t, task.Canceled, canceled.State())
+	})
+
+	t.Run("retry returns to pending", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return errors.New("transient")
+		}, task.LowPriority)
+		tsk.SetRetryPolicy(task.RetryPolicy{MaxAttempts: 2})
+
+		_ = tsk.Execute(context.Background())
+
+		assert.Equal(t, task.Pending, tsk.State())
+	})
+
+	t.Run("execute twice", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+
+		assert.NoError(t, tsk.Execute(context.Background()))
+		err := tsk.Execute(context.Background())
+
+		assert.ErrorIs(t, err, task.ErrInvalidTransition)
+		assert.Equal(t, 1, tsk.Attempts())
+	})
+
+	t.Run("unwatch", func(t *testing.T) {
+		watched := make(chan task.Transition, 3)
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		unwatch := tsk.Watch(func(tr task.Transition) {
+			watched <- tr
+		})
+		done := make(chan struct{})
+		tsk.Watch(func(tr task.Transition) {
+			if tr.To.IsTerminal() {
+				close(done)
+			}
+		})
+
+		assert.NoError(t, tsk.MarkReady())
+		assert.Equal(t, task.Ready, (<-watched).To)
+		unwatch()
+		_ = tsk.Execute(context.Background())
+
+		// Transitions are delivered in order, so the unregistered watcher would have been called by now.
+		<-done
+		assert.Empty(t, watched)
+	})
+
+}
+
+func TestTaskCancelWithCause(t *testing.T) {
+	cause := errors.New("no longer needed")
+
+	t.Run("before execute", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+
+		tsk.CancelWithCause(cause)
+
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.Equal(t, task.Canceled, tsk.State())
+		assert.ErrorIs(t, tsk.Err(), context.Canceled)
+		assert.ErrorIs(t, tsk.Err(), cause)
+	})
+
+	t.Run("during execute", func(t *testing.T) {
+		ctxCause := make(chan error, 1)
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			<-ctx.Done()
+			ctxCause <- context.Cause(ctx)
+			return ctx.Err()
+		}, task.LowPriority)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			tsk.CancelWithCause(cause)
+		}()
+
+		err := tsk.Execute(context.Background())
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, err, cause)
+		assert.Equal(t, task.Canceled, tsk.State())
+		assert.NoError(t, tsk.Wait(context.Background()))
+		assert.Equal(t, cause, <-ctxCause)
+	})
+
+	t.Run("after completion", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		_ = tsk.Execute(context.Background())
+
+		tsk.CancelWithCause(cause)
+
+		assert.Equal(t, task.Succeeded, tsk.State())
+		assert.NoError(t, tsk.Err())
+	})
+}
+
+func TestTaskPreempt(t *testing.T) {
+	// execute runs tsk until its function starts, then calls interrupt and returns the result of the attempt.
+	execute := func(tsk *task.Task, started <-chan struct{}, interrupt func()) error {
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- tsk.Execute(context.Background())
+		}()
+		<-started
+		interrupt()
+		return <-errChan
+	}
+
+	t.Run("requeued", func(t *testing.T) {
+		started := make(chan struct{}, 2)
+		ctxCause := make(chan error, 1)
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			started <- struct{}{}
+			if task.Attempt(ctx) > 1 {
+				return nil
+			}
+			<-ctx.Done()
+			ctxCause <- context.Cause(ctx)
+			return ctx.Err()
+		}, task.LowPriority)
+		tsk.SetPreemptible(true)
+		assert.True(t, tsk.Preemptible())
+
+		err := execute(tsk, started, func() {
+			assert.True(t, tsk.Preempt())
+		})
+		assert.ErrorIs(t, err, task.ErrPreempted)
+		assert.Equal(t, task.ErrPreempted, <-ctxCause)
+		assert.Equal(t, task.Pending, tsk.State())
+		assert.Equal(t, 1, tsk.Preemptions())
+		delay, retry := tsk.PendingRetry()
+		assert.True(t, retry)
+		assert.Zero(t, delay)
+
+		assert.NoError(t, tsk.Execute(context.Background()))
+		assert.Equal(t, task.Succeeded, tsk.State())
+		assert.Equal(t, 2, tsk.Attempts())
+	})
+
+	t.Run("not running", func(t *testing.T) {
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		assert.False(t, tsk.Preempt())
+		assert.NoError(t, tsk.Execute(context.Background()))
+		assert.False(t, tsk.Preempt())
+		assert.Zero(t, tsk.Preemptions())
+	})
+
+	t.Run("cancel takes precedence", func(t *testing.T) {
+		cause := errors.New("no longer needed")
+		started := make(chan struct{}, 1)
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}, task.LowPriority)
+
+		err := execute(tsk, started, func() {
+			assert.True(t, tsk.Preempt())
+			tsk.CancelWithCause(cause)
+			assert.False(t, tsk.Preempt())
+		})
+		assert.ErrorIs(t, err, cause)
+		assert.Equal(t, task.Canceled, tsk.State())
+		assert.Zero(t, tsk.Preemptions())
+	})
+
+	t.Run("not counted as a retry", func(t *testing.T) {
+		started := make(chan struct{}, 1)
+		tsk := task.NewTask("test_task", func(ctx context.Context) error {
+			if task.Attempt(ctx) > 1 {
+				return errors.New("failed")
+			}
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}, task.LowPriority)
+		tsk.SetRetryPolicy(task.RetryPolicy{MaxAttempts: 2})
+
+		_ = execute(tsk, started, func() {
+			assert.True(t, tsk.Preempt())
+		})
+		assert.Error(t, tsk.Execute(context.Background()))
+		_, retry := tsk.PendingRetry()
+		assert.True(t, retry)
+		assert.Error(t, tsk.Execute(context.Background()))
+		assert.Equal(t, task.Failed, tsk.State())
+		assert.Equal(t, 3, tsk.Attempts())
+	})
+}
+
+func TestTaskFollow(t *testing.T) {
+	t.Run("running original", func(t *testing.T) {
+		release := make(chan struct{})
+		original := task.NewTask("original", func(ctx context.Context) error {
+			<-release
+			return errors.New("failed")
+		}, task.LowPriority)
+		follower := task.NewTask("follower", func(ctx context.Context) error {
+			t.Error("follower ran")
+			return nil
+		}, task.LowPriority)
+
+		transitions := make(chan task.Transition, 3)
+		follower.Watch(func(tr task.Transition) {
+			transitions <- tr
+		})
+
+		go func() { _ = original.Execute(context.Background()) }()
+		follower.Follow(original)
+		assert.Equal(t, task.Pending, follower.State())
+
+		close(release)
+		assert.NoError(t, follower.Wait(context.Background()))
+		assert.Equal(t, task.Failed, follower.State())
+
+		// The follower moves through valid transitions to the original's outcome.
+		for _, to := range []task.State{task.Ready, task.Running, task.Failed} {
+			tr := <-transitions
+			assert.True(t, tr.From.CanTransitionTo(tr.To), "%s -> %s", tr.From, tr.To)
+			assert.Equal(t, to, tr.To)
+		}
+		assert.Equal(t, original.Err(), follower.Err())
+		assert.Equal(t, 1, follower.Attempts())
+		assert.Equal(t, original.StartedAt(), follower.StartedAt())
+	})
+
+	t.Run("completed original", func(t *testing.T) {
+		original := task.NewTask("original", func(ctx context.Context) error {
+			return nil
+		}, task.LowPriority)
+		assert.NoError(t, original.Execute(context.Background()))
+
+		follower := task.NewTask("follower", nil, task.LowPriority)
+		follower.Follow(original)
+		assert.Equal(t, task.Succeeded, follower.State())
+		assert.NoError(t, follower.Err())
+	})
+
+	t.Run("canceled follower", func(t *testing.T) {
+		release := make(chan struct{})
+		original := task.NewTask("original", func(ctx context.Context) error {
+			<-release
+			return nil
+		}, task.LowPriority)
+		follower := task.NewTask("follower", nil, task.LowPriority)
+		follower.Follow(original)
+		follower.Cancel()
+
+		go func() { _ = original.Execute(context.Background()) }()
+		close(release)
+		assert.NoError(t, original.Wait(context.Background()))
+		assert.Equal(t, task.Succeeded, original.State())
+		assert.Equal(t, task.Canceled, follower.State())
+	})
+}